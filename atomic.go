@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+// AtomicCache is implemented by Caches that support atomic read-modify-write
+// operations. Caches created by NewLRU and NewTTL implement AtomicCache. Each
+// method holds the Cache's lock for its duration. Writes made by these methods
+// mark the key as the most recently used and retain the entry's tags, if any; new
+// entries are untagged. In a Cache with expiration, writes reset the entry's TTL
+// and expired entries are treated as absent.
+type AtomicCache interface {
+	Cache
+
+	// AddIfAbsent adds an item to the cache if the key is not present. Returns
+	// true if the item was added.
+	AddIfAbsent(key, value interface{}) bool
+
+	// Replace replaces the value of an item in the cache if the key is present.
+	// Returns true if the item was replaced.
+	Replace(key, value interface{}) bool
+
+	// CompareAndSwap replaces the value of an item with new if the key is
+	// present and its value is equal to old. Values are compared with ==, except
+	// that values that cannot be compared, such as slices or structs holding
+	// them, are never equal. Returns true if the item was replaced.
+	CompareAndSwap(key, old, new interface{}) bool
+
+	// Compute invokes f with the key's current value, or nil, and whether the
+	// key is present. If f returns true, the value it returns is stored;
+	// otherwise the key is removed. Returns the value returned by f and whether
+	// it was stored. f must not call methods on the Cache.
+	Compute(key interface{}, f func(old interface{}, exists bool) (interface{}, bool)) (interface{}, bool)
+}
+
+// equalValues reports whether a and b are equal by ==, treating values that
+// cannot be compared, such as slices or structs and arrays holding them, as
+// unequal rather than panicking.
+func equalValues(a, b interface{}) (eq bool) {
+	defer func() {
+		if recover() != nil {
+			eq = false
+		}
+	}()
+
+	return a == b
+}
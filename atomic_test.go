@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+func testAtomicCache(t *testing.T, c AtomicCache) {
+	assert.True(t, c.AddIfAbsent("a", 1))
+	assert.False(t, c.AddIfAbsent("a", 2))
+
+	assert.True(t, c.Replace("a", 3))
+	assert.False(t, c.Replace("b", 1))
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+
+	assert.False(t, c.CompareAndSwap("a", 1, 4))
+	assert.True(t, c.CompareAndSwap("a", 3, 4))
+	assert.False(t, c.CompareAndSwap("b", nil, 1))
+
+	// Uncomparable values never match.
+	c.Add("bytes", []byte("x"))
+	assert.False(t, c.CompareAndSwap("bytes", []byte("x"), 1))
+	assert.False(t, c.CompareAndSwap("a", []byte("x"), 1))
+	c.Remove("bytes")
+
+	type holder struct{ v interface{} }
+	c.Add("holder", holder{[]int{1}})
+	assert.False(t, c.CompareAndSwap("holder", holder{[]int{1}}, 1))
+	c.Add("array", [1]interface{}{[]int{1}})
+	assert.False(t, c.CompareAndSwap("array", [1]interface{}{[]int{1}}, 1))
+	c.Add("holder", holder{1})
+	assert.True(t, c.CompareAndSwap("holder", holder{1}, 2))
+	c.Remove("holder")
+	c.Remove("array")
+
+	v, ok := c.Compute("a", func(old interface{}, exists bool) (interface{}, bool) {
+		assert.True(t, exists)
+		return old.(int) + 1, true
+	})
+	assert.Equal(t, v, 5)
+	assert.True(t, ok)
+
+	v, ok = c.Compute("b", func(old interface{}, exists bool) (interface{}, bool) {
+		assert.Nil(t, old)
+		assert.False(t, exists)
+		return 1, true
+	})
+	assert.Equal(t, v, 1)
+	assert.True(t, ok)
+
+	c.Compute("a", func(interface{}, bool) (interface{}, bool) { return nil, false })
+	assert.ArrayEqual(t, keys(c), []interface{}{"b"})
+
+	// Concurrent increments are not lost.
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Compute("n", func(old interface{}, exists bool) (interface{}, bool) {
+					if !exists {
+						return 1, true
+					}
+					return old.(int) + 1, true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, _ = c.Get("n")
+	assert.Equal(t, v, 1000)
+}
+
+func TestLRUCacheAtomic(t *testing.T) {
+	c, _ := NewLRU(10)
+	testAtomicCache(t, c.(AtomicCache))
+}
+
+func TestLRUCacheAtomicEvicts(t *testing.T) {
+	c, _ := NewLRU(2)
+	ac := c.(AtomicCache)
+
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	assert.True(t, ac.Replace("a", 3))
+	assert.True(t, ac.AddIfAbsent("c", 4))
+	ac.Compute("d", func(interface{}, bool) (interface{}, bool) { return 5, true })
+	assert.ArrayEqual(t, evicted, []interface{}{"b", "a"})
+}
+
+func TestTTLCacheAtomic(t *testing.T) {
+	c, _ := NewTTL(10, time.Minute)
+	testAtomicCache(t, c.(AtomicCache))
+}
+
+func TestTTLCacheAtomicExpiry(t *testing.T) {
+	c, _ := NewTTL(10, time.Minute)
+	ac := c.(AtomicCache)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		// Expired and negative entries are absent.
+		c.Add("a", 1)
+		c.(TTLCache).AddNegative("b", nil)
+		ts.Advance(time.Minute)
+		c.(TTLCache).AddNegative("c", nil)
+
+		assert.False(t, ac.Replace("a", 2))
+		assert.False(t, ac.CompareAndSwap("a", 1, 2))
+		assert.True(t, ac.AddIfAbsent("a", 2))
+		assert.False(t, ac.Replace("c", 2))
+		ac.Compute("c", func(old interface{}, exists bool) (interface{}, bool) {
+			assert.False(t, exists)
+			return 3, true
+		})
+
+		// Writes reset the TTL.
+		ts.Advance(30 * time.Second)
+		assert.True(t, ac.CompareAndSwap("a", 2, 4))
+		ts.Advance(30 * time.Second)
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, v, 4)
+		_, ok = c.Get("c")
+		assert.False(t, ok)
+	})
+}
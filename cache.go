@@ -47,6 +47,79 @@ type Cache interface {
 	Len() int
 }
 
+// KeyValue is a key and value in a Cache.
+type KeyValue struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// MultiCache is a Cache that supports operating on many keys at once. Each method
+// behaves as if the corresponding single-key method were invoked for each key in
+// order, but acquires the Cache's lock once. Caches created by NewNoopCache,
+// NewLRU and NewTTL implement MultiCache. The GetMulti, AddMulti and RemoveMulti
+// functions operate on any Cache.
+type MultiCache interface {
+	Cache
+
+	// GetMulti retrieves items from the cache. It returns the value for each
+	// key and whether each key was found, in the same order as keys.
+	GetMulti(keys []interface{}) ([]interface{}, []bool)
+
+	// AddMulti adds items to the cache. It returns whether each item replaced
+	// an existing item, in the same order as entries.
+	AddMulti(entries []KeyValue) []bool
+
+	// RemoveMulti removes items from the cache. It returns whether each key
+	// was removed, in the same order as keys.
+	RemoveMulti(keys []interface{}) []bool
+}
+
+// GetMulti retrieves items from c, using c's GetMulti method if it is a
+// MultiCache and invoking Get for each key otherwise.
+func GetMulti(c Cache, keys []interface{}) ([]interface{}, []bool) {
+	if mc, ok := c.(MultiCache); ok {
+		return mc.GetMulti(keys)
+	}
+
+	values := make([]interface{}, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		values[i], found[i] = c.Get(key)
+	}
+
+	return values, found
+}
+
+// AddMulti adds items to c, using c's AddMulti method if it is a MultiCache and
+// invoking Add for each entry otherwise.
+func AddMulti(c Cache, entries []KeyValue) []bool {
+	if mc, ok := c.(MultiCache); ok {
+		return mc.AddMulti(entries)
+	}
+
+	existed := make([]bool, len(entries))
+	for i, e := range entries {
+		existed[i] = c.Add(e.Key, e.Value)
+	}
+
+	return existed
+}
+
+// RemoveMulti removes items from c, using c's RemoveMulti method if it is a
+// MultiCache and invoking Remove for each key otherwise.
+func RemoveMulti(c Cache, keys []interface{}) []bool {
+	if mc, ok := c.(MultiCache); ok {
+		return mc.RemoveMulti(keys)
+	}
+
+	removed := make([]bool, len(keys))
+	for i, key := range keys {
+		removed[i] = c.Remove(key)
+	}
+
+	return removed
+}
+
 // NewNoopCache returns a Cache implementation that caches nothing.
 func NewNoopCache() Cache {
 	return &noopCache{}
@@ -60,3 +133,15 @@ func (*noopCache) Add(_, _ interface{}) bool             { return false }
 func (*noopCache) Remove(_ interface{}) bool             { return false }
 func (*noopCache) Clear()                                {}
 func (*noopCache) Len() int                              { return 0 }
+
+func (*noopCache) GetMulti(keys []interface{}) ([]interface{}, []bool) {
+	return make([]interface{}, len(keys)), make([]bool, len(keys))
+}
+
+func (*noopCache) AddMulti(entries []KeyValue) []bool {
+	return make([]bool, len(entries))
+}
+
+func (*noopCache) RemoveMulti(keys []interface{}) []bool {
+	return make([]bool, len(keys))
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNoopCacheMulti(t *testing.T) {
+	c := NewNoopCache().(MultiCache)
+
+	values, found := c.GetMulti([]interface{}{"a", "b"})
+	assert.ArrayEqual(t, values, []interface{}{nil, nil})
+	assert.ArrayEqual(t, found, []bool{false, false})
+	assert.ArrayEqual(t, c.AddMulti([]KeyValue{{"a", 1}}), []bool{false})
+	assert.ArrayEqual(t, c.RemoveMulti([]interface{}{"a"}), []bool{false})
+}
+
+func TestMultiFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMockCache(ctrl)
+	gomock.InOrder(
+		c.EXPECT().Get("a").Return(1, true),
+		c.EXPECT().Get("b").Return(nil, false),
+		c.EXPECT().Add("a", 2).Return(true),
+		c.EXPECT().Add("c", 3).Return(false),
+		c.EXPECT().Remove("a").Return(true),
+		c.EXPECT().Remove("d").Return(false),
+	)
+
+	values, found := GetMulti(c, []interface{}{"a", "b"})
+	assert.ArrayEqual(t, values, []interface{}{1, nil})
+	assert.ArrayEqual(t, found, []bool{true, false})
+
+	existed := AddMulti(c, []KeyValue{{"a", 2}, {"c", 3}})
+	assert.ArrayEqual(t, existed, []bool{true, false})
+
+	removed := RemoveMulti(c, []interface{}{"a", "d"})
+	assert.ArrayEqual(t, removed, []bool{true, false})
+}
+
+func TestMultiDelegates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	keys := []interface{}{"a", "b"}
+	entries := []KeyValue{{"a", 1}}
+
+	c := NewMockMultiCache(ctrl)
+	c.EXPECT().GetMulti(keys).Return([]interface{}{1, nil}, []bool{true, false})
+	c.EXPECT().AddMulti(entries).Return([]bool{true})
+	c.EXPECT().RemoveMulti(keys).Return([]bool{false, true})
+
+	values, found := GetMulti(c, keys)
+	assert.ArrayEqual(t, values, []interface{}{1, nil})
+	assert.ArrayEqual(t, found, []bool{true, false})
+	assert.ArrayEqual(t, AddMulti(c, entries), []bool{true})
+	assert.ArrayEqual(t, RemoveMulti(c, keys), []bool{false, true})
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// Codec creates Encoders and Decoders for a serialization format.
+type Codec interface {
+	// NewEncoder returns an Encoder that writes to w.
+	NewEncoder(w io.Writer) Encoder
+
+	// NewDecoder returns a Decoder that reads from r.
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Encoder writes a stream of values.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads a stream of values written by an Encoder.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// GobCodec is a Codec using encoding/gob. Keys and values are decoded with their
+// original types, but types other than gob's predeclared types must be registered
+// with gob.Register.
+var GobCodec Codec = gobCodec{}
+
+// JSONCodec is a Codec using encoding/json. Keys and values are decoded as generic
+// JSON values: numbers become float64, objects become map[string]interface{}, and
+// so on.
+var JSONCodec Codec = jsonCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder { return gob.NewEncoder(w) }
+func (gobCodec) NewDecoder(r io.Reader) Decoder { return gob.NewDecoder(r) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+func (jsonCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
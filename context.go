@@ -0,0 +1,287 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ContextLoader loads the value for a key. It should return promptly once ctx is
+// done.
+type ContextLoader func(ctx context.Context, key interface{}) (interface{}, error)
+
+// ContextCache is a Cache whose operations take a context.Context. Each method
+// returns ctx.Err() without acting if ctx is already done, and may return other
+// errors from the underlying cache or its backing stores.
+type ContextCache interface {
+	// Get retrieves an item from the cache. The second return value indicates
+	// whether an entry was found.
+	Get(ctx context.Context, key interface{}) (interface{}, bool, error)
+
+	// ForEach invokes f for each key/value in the cache. Callers should not
+	// depend on deterministic ordering.
+	ForEach(ctx context.Context, f func(key, value interface{})) error
+
+	// Add adds an item to the cache. Returns true if it replaced an existing
+	// item.
+	Add(ctx context.Context, key, value interface{}) (bool, error)
+
+	// Remove removes an item from the cache. Returns true if an item was
+	// removed.
+	Remove(ctx context.Context, key interface{}) (bool, error)
+
+	// Clear removes all items from the cache.
+	Clear(ctx context.Context) error
+
+	// Len returns the number of items in the cache.
+	Len(ctx context.Context) (int, error)
+
+	// GetOrLoad retrieves an item from the cache, or invokes load and adds the
+	// value it returns if there is none. Concurrent calls for the same key share
+	// a single invocation of load. If ctx is done before the value is available,
+	// GetOrLoad returns ctx.Err(), and once every caller sharing an invocation
+	// has returned this way, the context passed to load is cancelled. Errors
+	// returned by load are returned to every caller sharing the invocation and
+	// are not cached. Nor is the value, if every caller has returned or if the
+	// cache was written through this ContextCache during the load.
+	GetOrLoad(ctx context.Context, key interface{}, load ContextLoader) (interface{}, error)
+}
+
+// WithContext returns a ContextCache backed by c. Operations on c cannot be
+// interrupted, so a context only takes effect before an operation begins and
+// while GetOrLoad waits for a load. If c was returned by WithoutContext, the
+// ContextCache it wraps is returned.
+func WithContext(c Cache) ContextCache {
+	if wc, ok := c.(*withoutContext); ok {
+		return wc.cache
+	}
+
+	return &withContext{cache: c, loads: map[interface{}]*contextLoad{}}
+}
+
+// WithoutContext returns a Cache backed by c, which is invoked with
+// context.Background(). Errors are treated as misses or no-ops. If c was returned
+// by WithContext, the Cache it wraps is returned.
+func WithoutContext(c ContextCache) Cache {
+	if wc, ok := c.(*withContext); ok {
+		return wc.cache
+	}
+
+	return &withoutContext{c}
+}
+
+type withContext struct {
+	cache Cache
+	loads map[interface{}]*contextLoad
+
+	// writes counts the Adds, Removes and Clears made while holding lock, so
+	// that a load can detect writes made while it ran.
+	writes uint64
+	lock   sync.Mutex
+}
+
+// contextLoad is an invocation of a ContextLoader shared by the callers waiting
+// for it.
+type contextLoad struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	waiters int
+	writes  uint64
+	cancel  context.CancelFunc
+}
+
+// write records a write. The caller must hold c.lock.
+func (c *withContext) write() {
+	atomic.AddUint64(&c.writes, 1)
+}
+
+func (c *withContext) Get(ctx context.Context, key interface{}) (interface{}, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	value, ok := c.cache.Get(key)
+	return value, ok, nil
+}
+
+func (c *withContext) ForEach(ctx context.Context, f func(key, value interface{})) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.cache.ForEach(f)
+	return nil
+}
+
+func (c *withContext) Add(ctx context.Context, key, value interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write()
+	return c.cache.Add(key, value), nil
+}
+
+func (c *withContext) Remove(ctx context.Context, key interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write()
+	return c.cache.Remove(key), nil
+}
+
+func (c *withContext) Clear(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write()
+	c.cache.Clear()
+	return nil
+}
+
+func (c *withContext) Len(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.cache.Len(), nil
+}
+
+func (c *withContext) GetOrLoad(
+	ctx context.Context,
+	key interface{},
+	load ContextLoader,
+) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	writes := atomic.LoadUint64(&c.writes)
+	if value, ok := c.cache.Get(key); ok {
+		return value, nil
+	}
+
+	c.lock.Lock()
+	l, ok := c.loads[key]
+	if !ok {
+		// The load is shared, so it must not be cancelled along with the
+		// context of the caller that happened to start it.
+		loadCtx, cancel := context.WithCancel(context.Background())
+		l = &contextLoad{done: make(chan struct{}), writes: writes, cancel: cancel}
+		c.loads[key] = l
+		go c.load(loadCtx, key, load, l)
+	}
+	l.waiters++
+	c.lock.Unlock()
+
+	select {
+	case <-l.done:
+		return l.value, l.err
+
+	case <-ctx.Done():
+		c.lock.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			l.cancel()
+			c.forget(key, l)
+		}
+		c.lock.Unlock()
+
+		return nil, ctx.Err()
+	}
+}
+
+// load invokes loader and publishes its result to the callers waiting on l. The
+// value is cached only if a caller is still waiting, since ctx is cancelled under
+// c.lock once none is, and if no write was made since the caller that started the
+// load checked the cache.
+func (c *withContext) load(ctx context.Context, key interface{}, loader ContextLoader, l *contextLoad) {
+	value, err := loader(ctx, key)
+
+	c.lock.Lock()
+	if err == nil && ctx.Err() == nil && atomic.LoadUint64(&c.writes) == l.writes {
+		c.cache.Add(key, value)
+	}
+	l.value, l.err = value, err
+	c.forget(key, l)
+	c.lock.Unlock()
+
+	l.cancel()
+	close(l.done)
+}
+
+// forget removes l from the loads in progress unless it has been replaced by a
+// newer load.
+func (c *withContext) forget(key interface{}, l *contextLoad) {
+	if c.loads[key] == l {
+		delete(c.loads, key)
+	}
+}
+
+type withoutContext struct {
+	cache ContextCache
+}
+
+func (c *withoutContext) Get(key interface{}) (interface{}, bool) {
+	value, ok, err := c.cache.Get(context.Background(), key)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, ok
+}
+
+func (c *withoutContext) ForEach(f func(key, value interface{})) {
+	c.cache.ForEach(context.Background(), f)
+}
+
+func (c *withoutContext) Add(key, value interface{}) bool {
+	existed, _ := c.cache.Add(context.Background(), key, value)
+	return existed
+}
+
+func (c *withoutContext) Remove(key interface{}) bool {
+	removed, _ := c.cache.Remove(context.Background(), key)
+	return removed
+}
+
+func (c *withoutContext) Clear() {
+	c.cache.Clear(context.Background())
+}
+
+func (c *withoutContext) Len() int {
+	n, err := c.cache.Len(context.Background())
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestWithContext(t *testing.T) {
+	c, _ := NewLRU(2)
+	cc := WithContext(c)
+	ctx := context.Background()
+
+	existed, err := cc.Add(ctx, "a", 1)
+	assert.False(t, existed)
+	assert.Nil(t, err)
+
+	v, ok, err := cc.Get(ctx, "a")
+	assert.Equal(t, v, 1)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	n, err := cc.Len(ctx)
+	assert.Equal(t, n, 1)
+	assert.Nil(t, err)
+
+	seen := map[interface{}]interface{}{}
+	assert.Nil(t, cc.ForEach(ctx, func(k, v interface{}) { seen[k] = v }))
+	assert.DeepEqual(t, seen, map[interface{}]interface{}{"a": 1})
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = cc.Add(cancelled, "b", 2)
+	assert.Equal(t, err, context.Canceled)
+	_, ok, err = cc.Get(cancelled, "a")
+	assert.False(t, ok)
+	assert.Equal(t, err, context.Canceled)
+	_, err = cc.Remove(cancelled, "a")
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, cc.Clear(cancelled), context.Canceled)
+	assert.Equal(t, c.Len(), 1)
+
+	removed, err := cc.Remove(ctx, "a")
+	assert.True(t, removed)
+	assert.Nil(t, err)
+
+	cc.Add(ctx, "b", 2)
+	assert.Nil(t, cc.Clear(ctx))
+	assert.Equal(t, c.Len(), 0)
+
+	assert.Equal(t, WithoutContext(cc), c)
+}
+
+type failingContextCache struct {
+	ContextCache
+}
+
+func (failingContextCache) Get(context.Context, interface{}) (interface{}, bool, error) {
+	return 1, true, errors.New("boom")
+}
+
+func (failingContextCache) Len(context.Context) (int, error) {
+	return 3, errors.New("boom")
+}
+
+func TestWithoutContext(t *testing.T) {
+	c, _ := NewLRU(2)
+	cc := struct{ ContextCache }{WithContext(c)}
+	wc := WithoutContext(cc)
+
+	assert.False(t, wc.Add("a", 1))
+	v, ok := wc.Get("a")
+	assert.Equal(t, v, 1)
+	assert.True(t, ok)
+	assert.Equal(t, wc.Len(), 1)
+	assert.ArrayEqual(t, keys(wc), []interface{}{"a"})
+	assert.True(t, wc.Remove("a"))
+	wc.Add("b", 2)
+	wc.Clear()
+	assert.Equal(t, c.Len(), 0)
+
+	assert.Equal(t, WithContext(wc), cc)
+
+	failing := WithoutContext(failingContextCache{})
+	v, ok = failing.Get("a")
+	assert.Nil(t, v)
+	assert.False(t, ok)
+	assert.Equal(t, failing.Len(), 0)
+}
+
+func TestContextCacheGetOrLoad(t *testing.T) {
+	c, _ := NewLRU(2)
+	cc := WithContext(c)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	calls := 0
+	load := func(_ context.Context, key interface{}) (interface{}, error) {
+		calls++
+		<-release
+		return key.(string) + "!", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cc.GetOrLoad(ctx, "a", load)
+		}(i)
+	}
+
+	for {
+		cc.(*withContext).lock.Lock()
+		l := cc.(*withContext).loads["a"]
+		waiters := 0
+		if l != nil {
+			waiters = l.waiters
+		}
+		cc.(*withContext).lock.Unlock()
+		if waiters == 3 {
+			break
+		}
+	}
+
+	close(release)
+	wg.Wait()
+
+	assert.ArrayEqual(t, results, []interface{}{"a!", "a!", "a!"})
+	assert.Equal(t, calls, 1)
+
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, v, "a!")
+
+	v, err := cc.GetOrLoad(ctx, "a", load)
+	assert.Equal(t, v, "a!")
+	assert.Nil(t, err)
+	assert.Equal(t, calls, 1)
+
+	v, err = cc.GetOrLoad(ctx, "b", func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	assert.Nil(t, v)
+	assert.ErrorContains(t, err, "boom")
+	assert.False(t, c.Remove("b"))
+	assert.Equal(t, len(cc.(*withContext).loads), 0)
+}
+
+func TestContextCacheGetOrLoadCancel(t *testing.T) {
+	c, _ := NewLRU(2)
+	cc := WithContext(c)
+
+	started := make(chan struct{})
+	loadDone := make(chan error)
+	load := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		loadDone <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := cc.GetOrLoad(ctx1, "a", load)
+		errs <- err
+	}()
+	<-started
+
+	go func() {
+		_, err := cc.GetOrLoad(ctx2, "a", load)
+		errs <- err
+	}()
+
+	for {
+		cc.(*withContext).lock.Lock()
+		waiters := cc.(*withContext).loads["a"].waiters
+		cc.(*withContext).lock.Unlock()
+		if waiters == 2 {
+			break
+		}
+	}
+
+	// The load continues while any caller is waiting.
+	cancel1()
+	assert.Equal(t, <-errs, context.Canceled)
+	select {
+	case <-loadDone:
+		t.Fatal("load cancelled with a caller waiting")
+	default:
+	}
+
+	cancel2()
+	assert.Equal(t, <-errs, context.Canceled)
+	assert.Equal(t, <-loadDone, context.Canceled)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cc.GetOrLoad(cancelled, "a", load)
+	assert.Equal(t, err, context.Canceled)
+}
+
+func TestContextCacheGetOrLoadDoesNotOverwriteWrites(t *testing.T) {
+	c, _ := NewLRU(2)
+	cc := WithContext(c)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func(_ context.Context, key interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return key.(string) + "!", nil
+	}
+
+	got := make(chan interface{})
+	go func() {
+		v, _ := cc.GetOrLoad(ctx, "a", load)
+		got <- v
+	}()
+	<-started
+
+	cc.Add(ctx, "a", "added")
+	close(release)
+	assert.Equal(t, <-got, "a!")
+
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, v, "added")
+}
+
+func TestContextCacheGetOrLoadAbandoned(t *testing.T) {
+	c, _ := NewLRU(2)
+	cc := WithContext(c)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func(_ context.Context, key interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return key.(string) + "!", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := cc.GetOrLoad(ctx, "a", load)
+		errs <- err
+	}()
+	<-started
+
+	cc.(*withContext).lock.Lock()
+	l := cc.(*withContext).loads["a"]
+	cc.(*withContext).lock.Unlock()
+
+	cancel()
+	assert.Equal(t, <-errs, context.Canceled)
+	close(release)
+	<-l.done
+
+	assert.Equal(t, l.value, "a!")
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
@@ -16,6 +16,12 @@ limitations under the License.
 
 package cache
 
+// KeyCount is a key and its count in a CountingCache.
+type KeyCount struct {
+	Key   string
+	Count int
+}
+
 // CountingCache represents a Cache specialized for counting strings.
 type CountingCache interface {
 	// Get retrieves the count for the given key.
@@ -25,6 +31,19 @@ type CountingCache interface {
 	// on deterministic ordering.
 	ForEach(f func(key string, count int))
 
+	// ForEachSorted invokes f for each key/count in the cache in descending order of
+	// count, stopping early if f returns false. The order of keys with equal counts
+	// is not deterministic.
+	ForEachSorted(f func(key string, count int) bool)
+
+	// TopK returns up to k keys with the largest counts in descending order of
+	// count.
+	TopK(k int) []KeyCount
+
+	// BottomK returns up to k keys with the smallest counts in ascending order of
+	// count.
+	BottomK(k int) []KeyCount
+
 	// Inc increases the count for the given key by n, which may be negative. Return
 	// its new value.
 	Add(key string, n int) int
@@ -43,6 +62,22 @@ type CountingCache interface {
 
 	// Len returns the number of entries in the cache.
 	Len() int
+
+	// Snapshot returns a copy of the counts in the cache, which may be serialized
+	// or merged with snapshots of other caches.
+	Snapshot() CountingSnapshot
+}
+
+// clampK limits k to the range [0, n].
+func clampK(k, n int) int {
+	switch {
+	case k < 0:
+		return 0
+	case k > n:
+		return n
+	default:
+		return k
+	}
 }
 
 // NewNoopCountingCache returns a CountingCache implementation that counts nothing.
@@ -52,11 +87,15 @@ func NewNoopCountingCache() CountingCache {
 
 type noopCountingCache struct{}
 
-func (*noopCountingCache) Get(_ string) int                { return 0 }
-func (*noopCountingCache) ForEach(_ func(_ string, _ int)) {}
-func (*noopCountingCache) Add(_ string, n int) int         { return n }
-func (*noopCountingCache) Inc(_ string) int                { return 1 }
-func (*noopCountingCache) Dec(_ string) int                { return 0 }
-func (*noopCountingCache) Remove(_ string) int             { return 0 }
-func (*noopCountingCache) Clear()                          {}
-func (*noopCountingCache) Len() int                        { return 0 }
+func (*noopCountingCache) Get(_ string) int                           { return 0 }
+func (*noopCountingCache) ForEach(_ func(_ string, _ int))            {}
+func (*noopCountingCache) ForEachSorted(_ func(_ string, _ int) bool) {}
+func (*noopCountingCache) TopK(_ int) []KeyCount                      { return nil }
+func (*noopCountingCache) BottomK(_ int) []KeyCount                   { return nil }
+func (*noopCountingCache) Add(_ string, n int) int                    { return n }
+func (*noopCountingCache) Inc(_ string) int                           { return 1 }
+func (*noopCountingCache) Dec(_ string) int                           { return 0 }
+func (*noopCountingCache) Remove(_ string) int                        { return 0 }
+func (*noopCountingCache) Clear()                                     {}
+func (*noopCountingCache) Len() int                                   { return 0 }
+func (*noopCountingCache) Snapshot() CountingSnapshot                 { return CountingSnapshot{} }
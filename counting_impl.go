@@ -43,11 +43,14 @@ func NewCountingCache(size int) (CountingCache, error) {
 }
 
 type counting struct {
-	size   int
-	lookup map[string]*count
-	counts counts
-	rng    *rand.Rand
-	lock   sync.RWMutex
+	size      int
+	lookup    map[string]*count
+	counts    counts
+	prefixes  *keyTrie
+	rng       *rand.Rand
+	truncated bool
+	dropped   int
+	lock      sync.RWMutex
 }
 
 type count struct {
@@ -70,6 +73,18 @@ func (c counts) find(n int) int {
 	return sort.Search(len(c), func(idx int) bool { return c[idx].n <= n })
 }
 
+// min returns the smallest count in the cache, or 0 if the cache is empty.
+func (cc *counting) min() int {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+
+	if len(cc.counts) == 0 {
+		return 0
+	}
+
+	return cc.counts[len(cc.counts)-1].n
+}
+
 func (cc *counting) Get(key string) int {
 	cc.lock.RLock()
 	defer cc.lock.RUnlock()
@@ -90,6 +105,46 @@ func (cc *counting) ForEach(f func(key string, count int)) {
 	}
 }
 
+func (cc *counting) ForEachSorted(f func(key string, count int) bool) {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+
+	for _, count := range cc.counts {
+		if !f(*(count.key), count.n) {
+			return
+		}
+	}
+}
+
+func (cc *counting) TopK(k int) []KeyCount {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+
+	k = clampK(k, len(cc.counts))
+
+	result := make([]KeyCount, 0, k)
+	for _, count := range cc.counts[:k] {
+		result = append(result, KeyCount{Key: *(count.key), Count: count.n})
+	}
+
+	return result
+}
+
+func (cc *counting) BottomK(k int) []KeyCount {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+
+	k = clampK(k, len(cc.counts))
+
+	result := make([]KeyCount, 0, k)
+	for i := len(cc.counts) - 1; i >= len(cc.counts)-k; i-- {
+		count := cc.counts[i]
+		result = append(result, KeyCount{Key: *(count.key), Count: count.n})
+	}
+
+	return result
+}
+
 func (cc *counting) Add(key string, n int) int {
 	cc.lock.Lock()
 	defer cc.lock.Unlock()
@@ -113,18 +168,12 @@ func (cc *counting) Add(key string, n int) int {
 	}
 
 	// Insure we stay under the maximum size.
-	for len(cc.counts) >= cc.size {
-		// Find the index of the first counts entry with the minimum count.
-		idx := cc.counts.dropStart()
-
-		// Pick one of the minimum count entries at random
-		pick := idx + cc.rng.Intn(len(cc.counts)-idx)
-		cc.remove(pick)
-	}
+	cc.shrink(cc.size - 1)
 
 	keyCopy := key
 	count := &count{n: n, key: &keyCopy}
 	cc.lookup[keyCopy] = count
+	cc.prefixes.insert(keyCopy)
 
 	cc.counts = append(cc.counts, count)
 	sort.Sort(cc.counts)
@@ -155,12 +204,95 @@ func (cc *counting) Remove(key string) int {
 	return 0
 }
 
+func (cc *counting) RemoveIf(pred func(key string, count int) bool) int {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	return cc.removeIf(func(c *count) bool { return pred(*(c.key), c.n) })
+}
+
+func (cc *counting) RemovePrefix(prefix string) int {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	index := indexKeys(&cc.prefixes, func(f func(key interface{})) {
+		for key := range cc.lookup {
+			f(key)
+		}
+	})
+
+	keys := index.withPrefix(prefix)
+	if len(keys) == 0 {
+		return 0
+	}
+
+	remove := make(map[*count]bool, len(keys))
+	for _, key := range keys {
+		remove[cc.lookup[key]] = true
+	}
+
+	return cc.removeIf(func(c *count) bool { return remove[c] })
+}
+
+// removeIf removes the counts matching pred in a single pass, preserving the sort
+// order of those remaining.
+func (cc *counting) removeIf(pred func(c *count) bool) int {
+	kept := cc.counts[:0]
+	for _, c := range cc.counts {
+		if pred(c) {
+			delete(cc.lookup, *(c.key))
+			cc.prefixes.remove(*(c.key))
+		} else {
+			kept = append(kept, c)
+		}
+	}
+
+	n := len(cc.counts) - len(kept)
+	for i := len(kept); i < len(cc.counts); i++ {
+		cc.counts[i] = nil
+	}
+	cc.counts = kept
+
+	return n
+}
+
+// Resize changes the maximum number of keys tracked by the cache. When shrinking,
+// keys are evicted as they are by Add. Size must be at least 2.
+func (cc *counting) Resize(size int) error {
+	if size < 2 {
+		return errors.New("minimum counting cache size is 2")
+	}
+
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	cc.shrink(size)
+	cc.size = size
+	return nil
+}
+
+// shrink evicts keys until at most n remain.
+func (cc *counting) shrink(n int) {
+	for len(cc.counts) > n {
+		// Find the index of the first counts entry with the minimum count.
+		idx := cc.counts.dropStart()
+
+		// Pick one of the minimum count entries at random
+		pick := idx + cc.rng.Intn(len(cc.counts)-idx)
+		cc.drop(cc.counts[pick].n)
+		cc.remove(pick)
+	}
+}
+
 func (cc *counting) Clear() {
 	cc.lock.Lock()
 	defer cc.lock.Unlock()
 
 	cc.lookup = map[string]*count{}
 	cc.counts = counts{}
+	cc.prefixes = nil
+	cc.truncated = false
+	cc.dropped = 0
 }
 
 func (cc *counting) Len() int {
@@ -170,6 +302,27 @@ func (cc *counting) Len() int {
 	return len(cc.counts)
 }
 
+func (cc *counting) Snapshot() CountingSnapshot {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+
+	kcs := make([]KeyCount, len(cc.counts))
+	for i, count := range cc.counts {
+		kcs[i] = KeyCount{Key: *(count.key), Count: count.n}
+	}
+
+	return newCountingSnapshot(cc.size, kcs, cc.truncated, cc.dropped)
+}
+
+// drop records that a count of n was evicted. Only positive counts can cause a
+// key's count to be underestimated, so only they are added to the total dropped.
+func (cc *counting) drop(n int) {
+	cc.truncated = true
+	if n > 0 {
+		cc.dropped += n
+	}
+}
+
 func (cc *counting) remove(idx int) {
 	if idx < 0 || idx >= len(cc.counts) {
 		return
@@ -179,6 +332,7 @@ func (cc *counting) remove(idx int) {
 
 	// delete it
 	delete(cc.lookup, *(c.key))
+	cc.prefixes.remove(*(c.key))
 
 	copy(cc.counts[idx:], cc.counts[idx+1:])
 	cc.counts = cc.counts[0 : len(cc.counts)-1]
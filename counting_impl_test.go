@@ -330,3 +330,158 @@ func TestCountingCacheClear(t *testing.T) {
 		"x:1",
 	})
 }
+
+func TestCountingCacheTopKBottomK(t *testing.T) {
+	c, _ := NewCountingCache(5)
+
+	c.Add("a", 1)
+	c.Add("b", 5)
+	c.Add("c", 3)
+	c.Add("d", 2)
+	c.Add("e", 4)
+
+	assert.ArrayEqual(t, c.TopK(2), []KeyCount{{"b", 5}, {"e", 4}})
+	assert.ArrayEqual(t, c.BottomK(2), []KeyCount{{"a", 1}, {"d", 2}})
+	assert.ArrayEqual(t, c.TopK(0), []KeyCount{})
+	assert.ArrayEqual(t, c.BottomK(-1), []KeyCount{})
+	assert.Equal(t, len(c.TopK(10)), 5)
+	assert.Equal(t, len(c.BottomK(10)), 5)
+}
+
+func TestCountingCacheForEachSorted(t *testing.T) {
+	c, _ := NewCountingCache(5)
+
+	c.Add("a", 1)
+	c.Add("b", 5)
+	c.Add("c", 3)
+	c.Add("d", 2)
+	c.Add("e", 4)
+
+	keys := []string{}
+	c.ForEachSorted(func(key string, _ int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.ArrayEqual(t, keys, []string{"b", "e", "c", "d", "a"})
+
+	keys = []string{}
+	c.ForEachSorted(func(key string, _ int) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	assert.ArrayEqual(t, keys, []string{"b", "e"})
+}
+
+func TestCountingCacheSnapshot(t *testing.T) {
+	c, _ := NewCountingCache(3)
+
+	c.Add("a", 5)
+	c.Add("b", 3)
+	c.Add("c", 1)
+
+	assert.DeepEqual(t, c.Snapshot(), CountingSnapshot{
+		Size:   3,
+		Counts: []SnapshotCount{{"a", 5, 0}, {"b", 3, 0}, {"c", 1, 0}},
+	})
+
+	c.Add("d", 2)
+	assert.DeepEqual(t, c.Snapshot(), CountingSnapshot{
+		Size:       3,
+		Counts:     []SnapshotCount{{"a", 5, 1}, {"b", 3, 1}, {"d", 2, 1}},
+		Truncated:  true,
+		ErrorBound: 1,
+	})
+
+	c.Clear()
+	assert.DeepEqual(t, c.Snapshot(), CountingSnapshot{
+		Size:   3,
+		Counts: []SnapshotCount{},
+	})
+}
+
+func TestCountingCacheSnapshotBoundsRepeatedEviction(t *testing.T) {
+	c, _ := NewCountingCache(2)
+
+	c.Add("x", 100)
+	for i := 0; i < 10; i++ {
+		c.Inc("y")
+		c.Inc("z")
+	}
+
+	truth := map[string]int{"x": 100, "y": 10, "z": 10}
+	s := c.Snapshot()
+	for _, sc := range s.Counts {
+		assert.True(t, truth[sc.Key] <= sc.Count+sc.Error)
+		delete(truth, sc.Key)
+	}
+
+	for _, n := range truth {
+		assert.True(t, n <= s.ErrorBound)
+	}
+}
+
+func TestCountingCacheRemoveIf(t *testing.T) {
+	c, _ := NewCountingCache(10)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+	c.Add("d", 4)
+
+	n := c.(CountingBulkRemover).RemoveIf(func(key string, count int) bool {
+		return count%2 == 0
+	})
+	assert.Equal(t, n, 2)
+	contains(t, c, []string{"a:1", "c:3"})
+	assert.ArrayEqual(t, c.TopK(2), []KeyCount{{"c", 3}, {"a", 1}})
+
+	c.Add("b", 5)
+	assert.ArrayEqual(t, c.TopK(3), []KeyCount{{"b", 5}, {"c", 3}, {"a", 1}})
+}
+
+func TestCountingCacheRemovePrefix(t *testing.T) {
+	c, _ := NewCountingCache(3)
+
+	c.Add("user/1", 1)
+	c.Add("user/2", 2)
+	c.Add("group/1", 3)
+	c.Add("user/3", 4)
+	assert.Nil(t, c.(*counting).prefixes)
+
+	assert.Equal(t, c.(CountingBulkRemover).RemovePrefix("user/"), 2)
+	contains(t, c, []string{"group/1:3"})
+	assert.Equal(t, c.(CountingBulkRemover).RemovePrefix("user/"), 0)
+
+	c.Add("user/4", 5)
+	assert.Equal(t, c.(CountingBulkRemover).RemovePrefix("user/"), 1)
+
+	c.Add("user/1", 1)
+	c.Clear()
+	assert.Equal(t, c.(CountingBulkRemover).RemovePrefix(""), 0)
+}
+
+func TestCountingCacheResize(t *testing.T) {
+	c, _ := NewCountingCache(4)
+	r := c.(Resizable)
+
+	c.Add("a", 4)
+	c.Add("b", 3)
+	c.Add("c", 2)
+	c.Add("d", 1)
+
+	assert.ErrorContains(t, r.Resize(1), "minimum counting cache size")
+
+	assert.Nil(t, r.Resize(2))
+	assert.Equal(t, c.(*counting).size, 2)
+	contains(t, c, []string{"a:4", "b:3"})
+	assert.DeepEqual(t, c.Snapshot(), CountingSnapshot{
+		Size:       2,
+		Counts:     []SnapshotCount{{"a", 4, 3}, {"b", 3, 3}},
+		Truncated:  true,
+		ErrorBound: 3,
+	})
+
+	assert.Nil(t, r.Resize(3))
+	c.Add("e", 1)
+	contains(t, c, []string{"a:4", "b:3", "e:1"})
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+)
+
+// CountingSnapshot is a serializable copy of the counts in a CountingCache.
+// Snapshots taken from several caches may be combined with
+// MergeCountingSnapshots.
+type CountingSnapshot struct {
+	// Size is the maximum number of keys retained by the snapshot. Zero
+	// indicates no maximum.
+	Size int `json:"size"`
+
+	// Counts holds the counted keys in descending order of count.
+	Counts []SnapshotCount `json:"counts"`
+
+	// Truncated is true if counts were discarded to keep the number of keys
+	// within Size.
+	Truncated bool `json:"truncated"`
+
+	// ErrorBound bounds the counts discarded when the snapshot was truncated:
+	// keys absent from Counts had at most this count, and no key's count was
+	// underestimated by more than this. Because a key may be discarded and
+	// added again many times, caches report the total of the counts they
+	// discarded; count-min caches, which never underestimate, report the
+	// largest estimate any key could have. It is zero unless Truncated is true.
+	ErrorBound int `json:"error_bound"`
+}
+
+// SnapshotCount is a key's count in a CountingSnapshot. If counts for the key
+// were discarded, its true count is at most Count + Error.
+type SnapshotCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	Error int    `json:"error,omitempty"`
+}
+
+// newCountingSnapshot creates a CountingSnapshot from counts sorted in descending
+// order. If the source cache discarded counts, dropped bounds the total it
+// discarded; every key may have lost up to that much.
+func newCountingSnapshot(
+	size int,
+	counts []KeyCount,
+	truncated bool,
+	dropped int,
+) CountingSnapshot {
+	if !truncated {
+		dropped = 0
+	}
+
+	snapshot := CountingSnapshot{
+		Size:       size,
+		Counts:     make([]SnapshotCount, len(counts)),
+		Truncated:  truncated,
+		ErrorBound: dropped,
+	}
+
+	for i, kc := range counts {
+		snapshot.Counts[i] = SnapshotCount{Key: kc.Key, Count: kc.Count, Error: dropped}
+	}
+
+	return snapshot
+}
+
+// MergeCountingSnapshots combines snapshots, typically taken from caches in
+// different processes, by summing the counts for each key. The result's Size is
+// the largest Size among the snapshots. If more keys than that remain, the keys
+// with the smallest counts are discarded and the result is marked truncated.
+//
+// Error bounds accumulate: a key absent from a truncated snapshot is assumed to
+// have had up to that snapshot's ErrorBound in it, and the result's ErrorBound
+// covers both keys absent from every snapshot and keys discarded by the merge.
+func MergeCountingSnapshots(snapshots ...CountingSnapshot) CountingSnapshot {
+	var (
+		size      int
+		bound     int
+		truncated bool
+	)
+
+	merged := map[string]*SnapshotCount{}
+	seenBound := map[string]int{}
+
+	for _, s := range snapshots {
+		if s.Size > size {
+			size = s.Size
+		}
+
+		if s.Truncated {
+			truncated = true
+			bound += s.ErrorBound
+		}
+
+		for _, sc := range s.Counts {
+			m, ok := merged[sc.Key]
+			if !ok {
+				m = &SnapshotCount{Key: sc.Key}
+				merged[sc.Key] = m
+			}
+
+			m.Count += sc.Count
+			m.Error += sc.Error
+			if s.Truncated {
+				seenBound[sc.Key] += s.ErrorBound
+			}
+		}
+	}
+
+	counts := make([]SnapshotCount, 0, len(merged))
+	for key, m := range merged {
+		// The key may have been discarded by snapshots it's absent from.
+		m.Error += bound - seenBound[key]
+		counts = append(counts, *m)
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Key < counts[j].Key
+	})
+
+	if size > 0 && len(counts) > size {
+		for _, sc := range counts[size:] {
+			if upper := sc.Count + sc.Error; upper > bound {
+				bound = upper
+			}
+		}
+
+		counts = counts[:size]
+		truncated = true
+	}
+
+	return CountingSnapshot{
+		Size:       size,
+		Counts:     counts,
+		Truncated:  truncated,
+		ErrorBound: bound,
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewCountingSnapshot(t *testing.T) {
+	s := newCountingSnapshot(5, []KeyCount{{"a", 3}, {"b", 1}}, false, 7)
+	assert.DeepEqual(t, s, CountingSnapshot{
+		Size:   5,
+		Counts: []SnapshotCount{{"a", 3, 0}, {"b", 1, 0}},
+	})
+
+	s = newCountingSnapshot(5, []KeyCount{{"a", 3}, {"b", 1}}, true, 2)
+	assert.DeepEqual(t, s, CountingSnapshot{
+		Size:       5,
+		Counts:     []SnapshotCount{{"a", 3, 2}, {"b", 1, 2}},
+		Truncated:  true,
+		ErrorBound: 2,
+	})
+}
+
+func TestMergeCountingSnapshots(t *testing.T) {
+	s1 := CountingSnapshot{
+		Size:   3,
+		Counts: []SnapshotCount{{"a", 5, 0}, {"b", 3, 0}},
+	}
+	s2 := CountingSnapshot{
+		Size:   4,
+		Counts: []SnapshotCount{{"b", 4, 0}, {"c", 1, 0}},
+	}
+
+	assert.DeepEqual(t, MergeCountingSnapshots(s1, s2), CountingSnapshot{
+		Size:   4,
+		Counts: []SnapshotCount{{"b", 7, 0}, {"a", 5, 0}, {"c", 1, 0}},
+	})
+
+	assert.DeepEqual(t, MergeCountingSnapshots(), CountingSnapshot{
+		Counts: []SnapshotCount{},
+	})
+}
+
+func TestMergeCountingSnapshotsTruncatesToSize(t *testing.T) {
+	s1 := CountingSnapshot{
+		Size:   2,
+		Counts: []SnapshotCount{{"a", 5, 0}, {"b", 3, 0}},
+	}
+	s2 := CountingSnapshot{
+		Size:   2,
+		Counts: []SnapshotCount{{"c", 4, 0}, {"d", 1, 0}},
+	}
+
+	assert.DeepEqual(t, MergeCountingSnapshots(s1, s2), CountingSnapshot{
+		Size:       2,
+		Counts:     []SnapshotCount{{"a", 5, 0}, {"c", 4, 0}},
+		Truncated:  true,
+		ErrorBound: 3,
+	})
+}
+
+func TestMergeCountingSnapshotsAccumulatesErrorBounds(t *testing.T) {
+	s1 := CountingSnapshot{
+		Size:       2,
+		Counts:     []SnapshotCount{{"a", 5, 1}, {"b", 3, 1}},
+		Truncated:  true,
+		ErrorBound: 1,
+	}
+	s2 := CountingSnapshot{
+		Size:       2,
+		Counts:     []SnapshotCount{{"a", 4, 2}, {"c", 3, 2}},
+		Truncated:  true,
+		ErrorBound: 2,
+	}
+	s3 := CountingSnapshot{
+		Size:   2,
+		Counts: []SnapshotCount{{"b", 1, 0}},
+	}
+
+	assert.DeepEqual(t, MergeCountingSnapshots(s1, s2, s3), CountingSnapshot{
+		Size: 2,
+		Counts: []SnapshotCount{
+			{"a", 9, 3},
+			// b may have been dropped by s2
+			{"b", 4, 3},
+		},
+		Truncated: true,
+		// c may have been dropped by s1
+		ErrorBound: 6,
+	})
+}
+
+func TestCountingSnapshotJSON(t *testing.T) {
+	c, _ := NewCountingCache(2)
+	c.Add("a", 2)
+	c.Add("b", 3)
+	c.Add("c", 1)
+
+	s := c.Snapshot()
+	bytes, err := json.Marshal(s)
+	assert.Nil(t, err)
+
+	var decoded CountingSnapshot
+	assert.Nil(t, json.Unmarshal(bytes, &decoded))
+	assert.DeepEqual(t, decoded, s)
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// NewCountMinCountingCache creates a CountingCache backed by a count-min sketch,
+// which overestimates counts by at most epsilon times the sum of all counts with
+// probability 1 - delta, both between 0 and 1. ForEach, Len and Snapshot report
+// only the topK keys with the largest estimated counts; topK must be at least 2.
+// Remove and negative additions may reduce the estimates of other keys.
+func NewCountMinCountingCache(epsilon, delta float64, topK int) (CountingCache, error) {
+	if epsilon <= 0 || epsilon >= 1 {
+		return nil, errors.New("epsilon must be between 0 and 1")
+	}
+
+	if delta <= 0 || delta >= 1 {
+		return nil, errors.New("delta must be between 0 and 1")
+	}
+
+	heavy, err := NewCountingCache(topK)
+	if err != nil {
+		return nil, err
+	}
+
+	width := int(math.Ceil(math.E / epsilon))
+	depth := int(math.Ceil(math.Log(1 / delta)))
+	if depth < 1 {
+		depth = 1
+	}
+
+	rows := make([][]int, depth)
+	for i := range rows {
+		rows[i] = make([]int, width)
+	}
+
+	return &countMin{
+		width: width,
+		rows:  rows,
+		heavy: heavy.(*counting),
+	}, nil
+}
+
+// countMin keeps an exact table of heavy hitters alongside the sketch, which cannot
+// enumerate its keys. A key enters the table when its estimate exceeds the
+// smallest count in a full table, and the table is re-estimated before it is
+// reported so that it agrees with Get.
+type countMin struct {
+	width     int
+	rows      [][]int
+	heavy     *counting
+	truncated bool
+	lock      sync.RWMutex
+}
+
+// hashString computes the 64-bit FNV-1a hash of s.
+func hashString(s string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// index returns the column for key in the given row, deriving each row's hash
+// from two halves of a single hash of the key.
+func (c *countMin) index(h uint64, row int) int {
+	h1 := uint32(h)
+	h2 := uint32(h>>32) | 1
+	return int((h1 + uint32(row)*h2) % uint32(c.width))
+}
+
+func (c *countMin) estimate(key string) int {
+	h := hashString(key)
+
+	est := 0
+	for i, row := range c.rows {
+		if n := row[c.index(h, i)]; i == 0 || n < est {
+			est = n
+		}
+	}
+
+	return est
+}
+
+func (c *countMin) update(key string, n int) int {
+	h := hashString(key)
+
+	est := 0
+	for i, row := range c.rows {
+		idx := c.index(h, i)
+		row[idx] += n
+		if i == 0 || row[idx] < est {
+			est = row[idx]
+		}
+	}
+
+	return est
+}
+
+// track records the estimated count for key in the heavy-hitter table, adding it
+// if it outranks the table's smallest count and removing it if its estimate is no
+// longer positive.
+func (c *countMin) track(key string, est int) {
+	if n := c.heavy.Get(key); n != 0 {
+		if est <= 0 {
+			c.heavy.Remove(key)
+		} else {
+			c.heavy.Add(key, est-n)
+		}
+		return
+	}
+
+	if est <= 0 {
+		return
+	}
+
+	if c.heavy.Len() >= c.heavy.size && est <= c.heavy.min() {
+		c.truncated = true
+		return
+	}
+
+	c.heavy.Add(key, est)
+}
+
+// reestimate updates the heavy-hitter table with the current estimate of each of
+// its keys.
+func (c *countMin) reestimate() {
+	keys := make([]string, 0, c.heavy.Len())
+	c.heavy.ForEach(func(key string, _ int) {
+		keys = append(keys, key)
+	})
+
+	for _, key := range keys {
+		c.track(key, c.estimate(key))
+	}
+}
+
+func (c *countMin) Get(key string) int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.estimate(key)
+}
+
+// ForEach invokes f for each key in the heavy-hitter table with its estimated
+// count.
+func (c *countMin) ForEach(f func(key string, count int)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reestimate()
+	c.heavy.ForEach(f)
+}
+
+// ForEachSorted invokes f for each key in the heavy-hitter table with its estimated
+// count, in descending order of count.
+func (c *countMin) ForEachSorted(f func(key string, count int) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reestimate()
+	c.heavy.ForEachSorted(f)
+}
+
+// TopK returns up to k keys from the heavy-hitter table with the largest estimated
+// counts.
+func (c *countMin) TopK(k int) []KeyCount {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reestimate()
+	return c.heavy.TopK(k)
+}
+
+// BottomK returns up to k keys from the heavy-hitter table with the smallest
+// estimated counts.
+func (c *countMin) BottomK(k int) []KeyCount {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reestimate()
+	return c.heavy.BottomK(k)
+}
+
+func (c *countMin) Add(key string, n int) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if n == 0 {
+		return c.estimate(key)
+	}
+
+	est := c.update(key, n)
+	c.track(key, est)
+	return est
+}
+
+func (c *countMin) Inc(key string) int {
+	return c.Add(key, 1)
+}
+
+func (c *countMin) Dec(key string) int {
+	return c.Add(key, -1)
+}
+
+func (c *countMin) Remove(key string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	prev := c.estimate(key)
+	if prev != 0 {
+		c.update(key, -prev)
+	}
+	c.heavy.Remove(key)
+
+	return prev
+}
+
+func (c *countMin) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, row := range c.rows {
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	c.heavy.Clear()
+	c.truncated = false
+}
+
+// Len returns the number of keys in the heavy-hitter table.
+func (c *countMin) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.heavy.Len()
+}
+
+func (c *countMin) Snapshot() CountingSnapshot {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reestimate()
+	snapshot := newCountingSnapshot(
+		c.heavy.size,
+		c.heavy.TopK(c.heavy.size),
+		c.truncated || c.heavy.truncated,
+		c.bound(),
+	)
+
+	for i := range snapshot.Counts {
+		snapshot.Counts[i].Error = 0
+	}
+
+	return snapshot
+}
+
+// bound returns an upper bound on the estimate of any key.
+func (c *countMin) bound() int {
+	bound := 0
+	for i, row := range c.rows {
+		max := 0
+		for _, n := range row {
+			if n > max {
+				max = n
+			}
+		}
+
+		if i == 0 || max < bound {
+			bound = max
+		}
+	}
+
+	return bound
+}
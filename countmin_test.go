@@ -0,0 +1,190 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewCountMinCountingCache(t *testing.T) {
+	c, err := NewCountMinCountingCache(0, 0.01, 10)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "epsilon must be")
+
+	c, err = NewCountMinCountingCache(0.01, 1, 10)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "delta must be")
+
+	c, err = NewCountMinCountingCache(0.01, 0.01, 1)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "minimum counting cache size")
+
+	c, err = NewCountMinCountingCache(0.01, 0.01, 10)
+	assert.Nil(t, err)
+	assert.NonNil(t, c)
+	impl := c.(*countMin)
+	assert.Equal(t, impl.width, 272)
+	assert.Equal(t, len(impl.rows), 5)
+	assert.Equal(t, impl.heavy.size, 10)
+}
+
+func TestCountMinCountingCacheAddGet(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.001, 0.001, 5)
+
+	assert.Equal(t, c.Add("a", 1), 1)
+	assert.Equal(t, c.Add("b", 2), 2)
+	assert.Equal(t, c.Add("a", 3), 4)
+	assert.Equal(t, c.Add("a", 0), 4)
+	assert.Equal(t, c.Inc("c"), 1)
+	assert.Equal(t, c.Dec("b"), 1)
+
+	assert.Equal(t, c.Get("a"), 4)
+	assert.Equal(t, c.Get("b"), 1)
+	assert.Equal(t, c.Get("c"), 1)
+	assert.Equal(t, c.Get("X"), 0)
+	assert.Equal(t, c.Len(), 3)
+
+	contains(t, c, []string{
+		"a:4",
+		"b:1",
+		"c:1",
+	})
+}
+
+func TestCountMinCountingCacheTracksHeavyHitters(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.001, 0.001, 3)
+
+	for i := 0; i < 1000; i++ {
+		c.Inc(fmt.Sprintf("key-%d", i))
+	}
+
+	c.Add("x", 100)
+	c.Add("y", 200)
+	c.Add("z", 300)
+	assert.Equal(t, c.Len(), 3)
+
+	contains(t, c, []string{
+		"x:100",
+		"y:200",
+		"z:300",
+	})
+
+	// Unbounded keys are still counted.
+	assert.GreaterThanEqual(t, c.Get("key-500"), 1)
+}
+
+func TestCountMinCountingCacheOverestimates(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.1, 0.1, 2)
+
+	for i := 0; i < 1000; i++ {
+		c.Inc(fmt.Sprintf("key-%d", i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		assert.GreaterThanEqual(t, c.Get(fmt.Sprintf("key-%d", i)), 1)
+	}
+}
+
+func TestCountMinCountingCacheRemove(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.001, 0.001, 5)
+
+	c.Add("a", 3)
+	c.Add("b", 2)
+
+	assert.Equal(t, c.Remove("a"), 3)
+	assert.Equal(t, c.Get("a"), 0)
+	assert.Equal(t, c.Remove("a"), 0)
+	assert.Equal(t, c.Len(), 1)
+
+	contains(t, c, []string{"b:2"})
+
+	assert.Equal(t, c.Add("b", -2), 0)
+	assert.Equal(t, c.Len(), 0)
+}
+
+func TestCountMinCountingCacheClear(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.001, 0.001, 5)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	c.Clear()
+	assert.Equal(t, c.Len(), 0)
+	assert.Equal(t, c.Get("a"), 0)
+	assert.Equal(t, c.Get("b"), 0)
+
+	c.Add("x", 1)
+	contains(t, c, []string{"x:1"})
+}
+
+func TestCountMinCountingCacheSorted(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.001, 0.001, 3)
+
+	c.Add("a", 1)
+	c.Add("b", 3)
+	c.Add("c", 2)
+
+	assert.ArrayEqual(t, c.TopK(2), []KeyCount{{"b", 3}, {"c", 2}})
+	assert.ArrayEqual(t, c.BottomK(1), []KeyCount{{"a", 1}})
+
+	keys := []string{}
+	c.ForEachSorted(func(key string, _ int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.ArrayEqual(t, keys, []string{"b", "c", "a"})
+}
+
+func TestCountMinCountingCacheSnapshot(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.001, 0.001, 2)
+
+	c.Add("a", 5)
+	c.Add("b", 3)
+	c.Add("c", 1)
+
+	assert.DeepEqual(t, c.Snapshot(), CountingSnapshot{
+		Size:       2,
+		Counts:     []SnapshotCount{{"a", 5, 0}, {"b", 3, 0}},
+		Truncated:  true,
+		ErrorBound: 5,
+	})
+}
+
+func TestCountMinCountingCacheReportsCurrentEstimates(t *testing.T) {
+	c, _ := NewCountMinCountingCache(0.5, 0.5, 10)
+
+	for i := 0; i < 10; i++ {
+		c.Add(fmt.Sprintf("key-%d", i), i+1)
+	}
+
+	counts := map[string]int{}
+	c.ForEach(func(key string, count int) {
+		counts[key] = count
+	})
+	assert.Equal(t, len(counts), 10)
+
+	for key, count := range counts {
+		assert.Equal(t, count, c.Get(key))
+	}
+
+	for _, kc := range c.TopK(10) {
+		assert.Equal(t, kc.Count, c.Get(kc.Key))
+	}
+}
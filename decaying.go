@@ -0,0 +1,321 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+)
+
+// maxDecayExponent bounds the growth factor applied to stored scores before they
+// are rescaled to avoid floating point overflow.
+const maxDecayExponent = 64
+
+// NewDecayingCountingCache creates a CountingCache whose counts decay
+// exponentially over time, halving every halfLife. Get, Add and ForEach return
+// decayed counts, rounded to the nearest integer, and keys whose count decays to
+// zero are removed. The cache tracks at most size unique keys; when it is full, the
+// next new key added replaces the key with the lowest decayed count. Size must be at
+// least 2.
+func NewDecayingCountingCache(size int, halfLife time.Duration) (CountingCache, error) {
+	if size < 2 {
+		return nil, errors.New("minimum counting cache size is 2")
+	}
+
+	if halfLife <= 0 {
+		return nil, errors.New("Must provide a positive half-life")
+	}
+
+	return &decaying{
+		size:       size,
+		halfLife:   halfLife,
+		lookup:     make(map[string]*decayScore, size),
+		scores:     make(decayScores, 0, size),
+		timeSource: tbntime.NewSource(),
+	}, nil
+}
+
+// decaying stores each key's score scaled by the growth factor at the time it was
+// last updated, relative to epoch. Dividing by the current growth factor yields the
+// decayed count. Because every score shares the same divisor, the relative order of
+// scores does not change as time passes.
+type decaying struct {
+	size       int
+	halfLife   time.Duration
+	epoch      time.Time
+	lookup     map[string]*decayScore
+	scores     decayScores
+	truncated  bool
+	dropped    int
+	timeSource tbntime.Source
+	lock       sync.Mutex
+}
+
+type decayScore struct {
+	v   float64
+	key string
+}
+
+type decayScores []*decayScore
+
+func (s decayScores) Len() int           { return len(s) }
+func (s decayScores) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s decayScores) Less(i, j int) bool { return s[i].v > s[j].v }
+
+func (c *decaying) growth(now time.Time) float64 {
+	return math.Exp2(now.Sub(c.epoch).Seconds() / c.halfLife.Seconds())
+}
+
+func (c *decaying) value(s *decayScore, g float64) int {
+	return int(math.Round(s.v / g))
+}
+
+// rescale moves the epoch to now when the cache is empty or when the growth factor
+// becomes large enough to risk overflow.
+func (c *decaying) rescale(now time.Time) {
+	if len(c.scores) == 0 {
+		c.epoch = now
+		return
+	}
+
+	exp := now.Sub(c.epoch).Seconds() / c.halfLife.Seconds()
+	if exp <= maxDecayExponent {
+		return
+	}
+
+	f := math.Exp2(-exp)
+	for _, s := range c.scores {
+		s.v *= f
+	}
+	c.epoch = now
+}
+
+// prune removes keys whose counts have decayed to zero.
+func (c *decaying) prune(g float64) {
+	live := c.scores[:0]
+	for _, s := range c.scores {
+		if c.value(s, g) == 0 {
+			delete(c.lookup, s.key)
+		} else {
+			live = append(live, s)
+		}
+	}
+
+	for i := len(live); i < len(c.scores); i++ {
+		c.scores[i] = nil
+	}
+	c.scores = live
+}
+
+func (c *decaying) remove(s *decayScore) {
+	idx := sort.Search(len(c.scores), func(i int) bool { return c.scores[i].v <= s.v })
+	for ; idx < len(c.scores); idx++ {
+		if c.scores[idx] == s {
+			break
+		}
+	}
+
+	if idx >= len(c.scores) {
+		return
+	}
+
+	delete(c.lookup, s.key)
+
+	copy(c.scores[idx:], c.scores[idx+1:])
+	c.scores[len(c.scores)-1] = nil
+	c.scores = c.scores[0 : len(c.scores)-1]
+}
+
+func (c *decaying) Get(key string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if s, ok := c.lookup[key]; ok {
+		return c.value(s, c.growth(c.timeSource.Now()))
+	}
+
+	return 0
+}
+
+func (c *decaying) ForEach(f func(key string, count int)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	g := c.growth(c.timeSource.Now())
+	c.prune(g)
+
+	for _, s := range c.scores {
+		f(s.key, c.value(s, g))
+	}
+}
+
+func (c *decaying) ForEachSorted(f func(key string, count int) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	g := c.growth(c.timeSource.Now())
+	c.prune(g)
+
+	for _, s := range c.scores {
+		if !f(s.key, c.value(s, g)) {
+			return
+		}
+	}
+}
+
+func (c *decaying) TopK(k int) []KeyCount {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	g := c.growth(c.timeSource.Now())
+	c.prune(g)
+
+	k = clampK(k, len(c.scores))
+	result := make([]KeyCount, 0, k)
+	for _, s := range c.scores[:k] {
+		result = append(result, KeyCount{Key: s.key, Count: c.value(s, g)})
+	}
+
+	return result
+}
+
+func (c *decaying) BottomK(k int) []KeyCount {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	g := c.growth(c.timeSource.Now())
+	c.prune(g)
+
+	k = clampK(k, len(c.scores))
+	result := make([]KeyCount, 0, k)
+	for i := len(c.scores) - 1; i >= len(c.scores)-k; i-- {
+		s := c.scores[i]
+		result = append(result, KeyCount{Key: s.key, Count: c.value(s, g)})
+	}
+
+	return result
+}
+
+func (c *decaying) Add(key string, n int) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.timeSource.Now()
+	c.rescale(now)
+	g := c.growth(now)
+
+	if s, ok := c.lookup[key]; ok {
+		// Update existing entry.
+		s.v += float64(n) * g
+		sort.Sort(c.scores)
+
+		v := c.value(s, g)
+		if v == 0 {
+			c.remove(s)
+		}
+
+		return v
+	}
+
+	// Only add new entries if their count is non-zero.
+	if n == 0 {
+		return n
+	}
+
+	// Drop decayed keys before evicting live ones.
+	c.prune(g)
+	for len(c.scores) >= c.size {
+		s := c.scores[len(c.scores)-1]
+		c.truncated = true
+		if v := c.value(s, g); v > 0 {
+			c.dropped += v
+		}
+		c.remove(s)
+	}
+
+	if len(c.scores) == 0 {
+		c.epoch = now
+		g = 1
+	}
+
+	s := &decayScore{v: float64(n) * g, key: key}
+	c.lookup[key] = s
+
+	c.scores = append(c.scores, s)
+	sort.Sort(c.scores)
+
+	return n
+}
+
+func (c *decaying) Inc(key string) int {
+	return c.Add(key, 1)
+}
+
+func (c *decaying) Dec(key string) int {
+	return c.Add(key, -1)
+}
+
+func (c *decaying) Remove(key string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if s, ok := c.lookup[key]; ok {
+		prev := c.value(s, c.growth(c.timeSource.Now()))
+		c.remove(s)
+		return prev
+	}
+
+	return 0
+}
+
+func (c *decaying) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lookup = map[string]*decayScore{}
+	c.scores = decayScores{}
+	c.truncated = false
+	c.dropped = 0
+}
+
+func (c *decaying) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.prune(c.growth(c.timeSource.Now()))
+	return len(c.scores)
+}
+
+func (c *decaying) Snapshot() CountingSnapshot {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	g := c.growth(c.timeSource.Now())
+	c.prune(g)
+
+	kcs := make([]KeyCount, len(c.scores))
+	for i, s := range c.scores {
+		kcs[i] = KeyCount{Key: s.key, Count: c.value(s, g)}
+	}
+
+	return newCountingSnapshot(c.size, kcs, c.truncated, c.dropped)
+}
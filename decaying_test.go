@@ -0,0 +1,171 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewDecayingCountingCache(t *testing.T) {
+	c, err := NewDecayingCountingCache(1, time.Minute)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "minimum counting cache size")
+
+	c, err = NewDecayingCountingCache(2, 0)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "positive half-life")
+
+	c, err = NewDecayingCountingCache(2, time.Minute)
+	assert.Nil(t, err)
+	assert.NonNil(t, c)
+	impl := c.(*decaying)
+	assert.Equal(t, impl.size, 2)
+	assert.Equal(t, impl.halfLife, time.Minute)
+	assert.NonNil(t, impl.lookup)
+	assert.NonNil(t, impl.scores)
+	assert.NonNil(t, impl.timeSource)
+}
+
+func TestDecayingCountingCacheAddGet(t *testing.T) {
+	c, _ := NewDecayingCountingCache(5, time.Hour)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*decaying).timeSource = ts
+
+		assert.Equal(t, c.Add("a", 1), 1)
+		assert.Equal(t, c.Add("b", 2), 2)
+		assert.Equal(t, c.Add("a", 3), 4)
+		assert.Equal(t, c.Inc("c"), 1)
+		assert.Equal(t, c.Dec("b"), 1)
+		assert.Equal(t, c.Add("x", 0), 0)
+
+		assert.Equal(t, c.Get("a"), 4)
+		assert.Equal(t, c.Get("b"), 1)
+		assert.Equal(t, c.Get("c"), 1)
+		assert.Equal(t, c.Get("x"), 0)
+		assert.Equal(t, c.Len(), 3)
+
+		assert.Equal(t, c.Dec("c"), 0)
+		assert.Equal(t, c.Len(), 2)
+	})
+}
+
+func TestDecayingCountingCacheDecays(t *testing.T) {
+	c, _ := NewDecayingCountingCache(5, time.Minute)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*decaying).timeSource = ts
+
+		c.Add("a", 16)
+		c.Add("b", 3)
+
+		ts.Advance(time.Minute)
+		assert.Equal(t, c.Get("a"), 8)
+		assert.Equal(t, c.Get("b"), 2)
+		contains(t, c, []string{"a:8", "b:2"})
+
+		assert.Equal(t, c.Add("a", 8), 16)
+
+		ts.Advance(2 * time.Minute)
+		assert.Equal(t, c.Get("a"), 4)
+		assert.Equal(t, c.Get("b"), 0)
+
+		// b has decayed away
+		assert.Equal(t, c.Len(), 1)
+		contains(t, c, []string{"a:4"})
+
+		assert.Equal(t, c.Remove("a"), 4)
+		assert.Equal(t, c.Len(), 0)
+	})
+}
+
+func TestDecayingCountingCacheEvictsLowestDecayedCount(t *testing.T) {
+	c, _ := NewDecayingCountingCache(2, time.Minute)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*decaying).timeSource = ts
+
+		// a starts higher than b but decays below it.
+		c.Add("a", 16)
+		ts.Advance(3 * time.Minute)
+		c.Add("b", 4)
+
+		c.Add("c", 1)
+		assert.Equal(t, c.Len(), 2)
+		contains(t, c, []string{"b:4", "c:1"})
+	})
+}
+
+func TestDecayingCountingCacheRescales(t *testing.T) {
+	c, _ := NewDecayingCountingCache(5, time.Second)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		impl := c.(*decaying)
+		impl.timeSource = ts
+
+		start := ts.Now()
+		c.Add("a", 1<<20)
+		for i := 0; i < 100; i++ {
+			ts.Advance(time.Second)
+			c.Inc("b")
+		}
+
+		assert.True(t, impl.epoch.After(start))
+		assert.Equal(t, c.Get("a"), 0)
+		assert.Equal(t, c.Get("b"), 2)
+	})
+}
+
+func TestDecayingCountingCacheClear(t *testing.T) {
+	c, _ := NewDecayingCountingCache(5, time.Minute)
+
+	c.Add("a", 10)
+	c.Add("b", 20)
+
+	c.Clear()
+	assert.Equal(t, c.Len(), 0)
+
+	c.Add("x", 1)
+	contains(t, c, []string{"x:1"})
+}
+
+func TestDecayingCountingCacheSorted(t *testing.T) {
+	c, _ := NewDecayingCountingCache(5, time.Minute)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*decaying).timeSource = ts
+
+		c.Add("a", 16)
+		ts.Advance(2 * time.Minute)
+		c.Add("b", 8)
+		c.Add("c", 1)
+
+		assert.ArrayEqual(t, c.TopK(2), []KeyCount{{"b", 8}, {"a", 4}})
+		assert.ArrayEqual(t, c.BottomK(1), []KeyCount{{"c", 1}})
+
+		keys := []string{}
+		c.ForEachSorted(func(key string, _ int) bool {
+			keys = append(keys, key)
+			return len(keys) < 2
+		})
+		assert.ArrayEqual(t, keys, []string{"b", "a"})
+	})
+}
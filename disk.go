@@ -0,0 +1,477 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+const (
+	// diskFrameHeaderLen is the size of the length and checksum preceding each
+	// record in the log.
+	diskFrameHeaderLen = 8
+
+	// DefaultDiskCompactSize is the log size above which a disk cache is
+	// compacted if no other size is configured.
+	DefaultDiskCompactSize = 64 << 20
+
+	maxInt = int(^uint(0) >> 1)
+)
+
+// DiskOptions configures a Cache created by NewDisk.
+type DiskOptions struct {
+	// Codec serializes keys and values. If nil, GobCodec is used. Keys must
+	// decode to values equal to the keys originally added, so JSONCodec is
+	// only suitable for string keys.
+	Codec Codec
+
+	// MaxEntries limits the number of entries in the cache. When adding a key
+	// would exceed the limit, the least recently used key is evicted, and its
+	// removal is recorded in the log. Zero means no limit.
+	MaxEntries int
+
+	// CompactSize is the log size, in bytes, above which the log is compacted
+	// once more than half of it is occupied by replaced or removed entries. If
+	// zero, DefaultDiskCompactSize is used.
+	CompactSize int64
+
+	// Sync causes each write to be flushed to stable storage before the
+	// operation returns.
+	Sync bool
+
+	// OnError, if non-nil, is invoked with errors reading or writing the log.
+	// Operations that fail are treated as misses or no-ops.
+	OnError func(error)
+}
+
+// DiskCache is a Cache that stores its entries in a file.
+type DiskCache interface {
+	Cache
+
+	// Compact rewrites the log so that it contains only live entries.
+	Compact() error
+
+	// Close closes the log. The DiskCache may not be used afterwards.
+	Close() error
+}
+
+// NewDisk opens or creates a DiskCache that stores entries in an append-only log
+// at path, with an in-memory index of keys. Values are read from the log on each
+// Get, making the cache suitable for values too large or too numerous to hold in
+// memory. When the log grows beyond opts.CompactSize and is mostly stale, it is
+// rewritten to a temporary file which then atomically replaces it.
+//
+// When an existing log is opened, its records are replayed to rebuild the index.
+// A partially written record at the end of the log, such as one left by a crash,
+// is discarded. Recency order is not persisted: after reopening, keys are ordered
+// by when they were last written.
+func NewDisk(path string, opts DiskOptions) (DiskCache, error) {
+	if opts.MaxEntries < 0 {
+		return nil, errors.New("Must provide a non-negative maximum number of entries")
+	}
+
+	if opts.Codec == nil {
+		opts.Codec = GobCodec
+	}
+
+	if opts.CompactSize <= 0 {
+		opts.CompactSize = DefaultDiskCompactSize
+	}
+
+	size := opts.MaxEntries
+	if size == 0 {
+		size = maxInt
+	}
+
+	c := &diskCache{path: path, opts: opts}
+
+	index, err := simplelru.NewLRU(size, c.onRemove)
+	if err != nil {
+		return nil, err
+	}
+	c.index = index
+
+	// A compaction interrupted by a crash leaves its output behind.
+	if err := os.Remove(c.compactPath()); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if c.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := c.recover(); err != nil {
+		c.file.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type diskCache struct {
+	path  string
+	opts  DiskOptions
+	file  *os.File
+	index *simplelru.LRU
+	size  int64
+	live  int64
+	lock  sync.Mutex
+}
+
+// diskRecord is the serialized form of an addition or removal.
+type diskRecord struct {
+	Remove bool
+	Key    interface{}
+	Value  interface{}
+}
+
+// diskEntry locates the most recent record for a key in the log.
+type diskEntry struct {
+	offset int64
+	length int64
+}
+
+func (c *diskCache) compactPath() string {
+	return c.path + ".compact"
+}
+
+func (c *diskCache) onRemove(_, value interface{}) {
+	c.live -= value.(*diskEntry).length
+}
+
+func (c *diskCache) reportError(err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
+
+// recover replays the log, truncating it after the last complete record.
+func (c *diskCache) recover() error {
+	info, err := c.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	header := make([]byte, diskFrameHeaderLen)
+
+	for {
+		if _, err := c.file.ReadAt(header, offset); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+
+		// Every encoded record is non-empty and within the log, so any other
+		// length indicates a torn write or corruption.
+		length := int64(binary.BigEndian.Uint32(header))
+		if length == 0 || length > info.Size()-offset-diskFrameHeaderLen {
+			break
+		}
+
+		payload := make([]byte, length)
+		if _, err := c.file.ReadAt(payload, offset+diskFrameHeaderLen); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+
+		var rec diskRecord
+		if err := c.opts.Codec.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+			return err
+		}
+
+		frameLen := diskFrameHeaderLen + length
+		if rec.Remove {
+			c.index.Remove(rec.Key)
+		} else {
+			c.put(rec.Key, &diskEntry{offset: offset, length: frameLen})
+		}
+
+		offset += frameLen
+	}
+
+	if err := c.file.Truncate(offset); err != nil {
+		return err
+	}
+	c.size = offset
+
+	return nil
+}
+
+// put indexes e as the location of key's value and returns whether key was
+// already present.
+func (c *diskCache) put(key interface{}, e *diskEntry) bool {
+	old, existed := c.index.Peek(key)
+	if existed {
+		c.live -= old.(*diskEntry).length
+	}
+
+	c.live += e.length
+	c.index.Add(key, e)
+	return existed
+}
+
+// append writes rec to the end of the log and returns its location.
+func (c *diskCache) append(rec *diskRecord) (*diskEntry, error) {
+	buf := &bytes.Buffer{}
+	buf.Write(make([]byte, diskFrameHeaderLen))
+	if err := c.opts.Codec.NewEncoder(buf).Encode(rec); err != nil {
+		return nil, err
+	}
+
+	frame := buf.Bytes()
+	payload := frame[diskFrameHeaderLen:]
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(payload))
+
+	if _, err := c.file.WriteAt(frame, c.size); err != nil {
+		// Discard any partial write.
+		c.file.Truncate(c.size)
+		return nil, err
+	}
+
+	if c.opts.Sync {
+		if err := c.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	e := &diskEntry{offset: c.size, length: int64(len(frame))}
+	c.size += e.length
+	return e, nil
+}
+
+// evict records the removal of the least recently used key in the log and removes
+// it from the index. Recording the removal before the addition that caused it
+// ensures that replaying the log evicts the same key.
+func (c *diskCache) evict() error {
+	key, _, ok := c.index.GetOldest()
+	if !ok {
+		return nil
+	}
+
+	if _, err := c.append(&diskRecord{Remove: true, Key: key}); err != nil {
+		return err
+	}
+
+	c.index.Remove(key)
+	return nil
+}
+
+func (c *diskCache) read(e *diskEntry) (interface{}, error) {
+	payload := make([]byte, e.length-diskFrameHeaderLen)
+	if _, err := c.file.ReadAt(payload, e.offset+diskFrameHeaderLen); err != nil {
+		return nil, err
+	}
+
+	var rec diskRecord
+	if err := c.opts.Codec.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+		return nil, err
+	}
+
+	return rec.Value, nil
+}
+
+func (c *diskCache) maybeCompact() {
+	if c.size > c.opts.CompactSize && c.size-c.live > c.live {
+		if err := c.compact(); err != nil {
+			c.reportError(err)
+		}
+	}
+}
+
+// compact copies the records of live entries to a new log and replaces the
+// current log with it.
+func (c *diskCache) compact() error {
+	out, err := os.OpenFile(c.compactPath(), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	keys := c.index.Keys()
+	offsets := make([]int64, len(keys))
+
+	var offset int64
+	for i, key := range keys {
+		v, _ := c.index.Peek(key)
+		e := v.(*diskEntry)
+
+		frame := make([]byte, e.length)
+		if _, err = c.file.ReadAt(frame, e.offset); err != nil {
+			break
+		}
+
+		if _, err = out.WriteAt(frame, offset); err != nil {
+			break
+		}
+
+		offsets[i] = offset
+		offset += e.length
+	}
+
+	if err == nil {
+		err = out.Sync()
+	}
+
+	if err == nil {
+		err = os.Rename(c.compactPath(), c.path)
+	}
+
+	if err != nil {
+		out.Close()
+		os.Remove(c.compactPath())
+		return err
+	}
+
+	c.file.Close()
+	c.file = out
+
+	for i, key := range keys {
+		v, _ := c.index.Peek(key)
+		v.(*diskEntry).offset = offsets[i]
+	}
+	c.size = offset
+
+	return nil
+}
+
+func (c *diskCache) Get(key interface{}) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	v, ok := c.index.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	value, err := c.read(v.(*diskEntry))
+	if err != nil {
+		c.reportError(err)
+		return nil, false
+	}
+
+	return value, true
+}
+
+// ForEach iterates over the key-value pairs in the Cache from least to most
+// recently used, reading each value from the log.
+func (c *diskCache) ForEach(f func(key, value interface{})) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, key := range c.index.Keys() {
+		v, _ := c.index.Peek(key)
+		value, err := c.read(v.(*diskEntry))
+		if err != nil {
+			c.reportError(err)
+			continue
+		}
+
+		f(key, value)
+	}
+}
+
+func (c *diskCache) Add(key, value interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	max := c.opts.MaxEntries
+	if max > 0 && c.index.Len() >= max && !c.index.Contains(key) {
+		if err := c.evict(); err != nil {
+			c.reportError(err)
+			return false
+		}
+	}
+
+	e, err := c.append(&diskRecord{Key: key, Value: value})
+	if err != nil {
+		c.reportError(err)
+		return c.index.Contains(key)
+	}
+
+	existed := c.put(key, e)
+	c.maybeCompact()
+	return existed
+}
+
+func (c *diskCache) Remove(key interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.index.Contains(key) {
+		return false
+	}
+
+	if _, err := c.append(&diskRecord{Remove: true, Key: key}); err != nil {
+		c.reportError(err)
+		return false
+	}
+
+	c.index.Remove(key)
+	c.maybeCompact()
+	return true
+}
+
+func (c *diskCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.file.Truncate(0); err != nil {
+		c.reportError(err)
+		return
+	}
+
+	c.index.Purge()
+	c.size = 0
+	c.live = 0
+}
+
+func (c *diskCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.index.Len()
+}
+
+func (c *diskCache) Compact() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.compact()
+}
+
+func (c *diskCache) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.file.Close()
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func withDiskPath(t *testing.T, f func(path string)) {
+	dir, err := ioutil.TempDir("", "disk-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f(filepath.Join(dir, "cache.log"))
+}
+
+func TestNewDisk(t *testing.T) {
+	withDiskPath(t, func(path string) {
+		c, err := NewDisk(path, DiskOptions{MaxEntries: -1})
+		assert.Nil(t, c)
+		assert.ErrorContains(t, err, "non-negative maximum number of entries")
+
+		c, err = NewDisk(filepath.Join(path, "nope", "nope"), DiskOptions{})
+		assert.Nil(t, c)
+		assert.NonNil(t, err)
+
+		c, err = NewDisk(path, DiskOptions{})
+		assert.Nil(t, err)
+		assert.NonNil(t, c)
+		defer c.Close()
+
+		impl := c.(*diskCache)
+		assert.Equal(t, impl.opts.Codec, GobCodec)
+		assert.Equal(t, impl.opts.CompactSize, int64(DefaultDiskCompactSize))
+		assert.NonNil(t, impl.index)
+		assert.NonNil(t, impl.file)
+	})
+}
+
+func TestDiskCacheBasicOperations(t *testing.T) {
+	withDiskPath(t, func(path string) {
+		c, err := NewDisk(path, DiskOptions{})
+		assert.Nil(t, err)
+		defer c.Close()
+
+		assert.False(t, c.Add("k1", "v1"))
+		assert.False(t, c.Add("k2", "v2"))
+		assert.False(t, c.Add("k3", "v3"))
+		assert.True(t, c.Add("k1", "v1-again"))
+		assert.Equal(t, c.Len(), 3)
+
+		assert.True(t, c.Remove("k3"))
+		assert.Equal(t, c.Len(), 2)
+
+		assert.False(t, c.Remove("never-added"))
+		assert.Equal(t, c.Len(), 2)
+
+		v1, ok1 := c.Get("k1")
+		assert.True(t, ok1)
+		assert.Equal(t, v1, "v1-again")
+
+		v2, ok2 := c.Get("k2")
+		assert.True(t, ok2)
+		assert.Equal(t, v2, "v2")
+
+		kvs := map[interface{}]interface{}{}
+		c.ForEach(func(k, v interface{}) { kvs[k] = v })
+		assert.MapEqual(t, kvs, map[interface{}]interface{}{"k1": "v1-again", "k2": "v2"})
+
+		c.Clear()
+		assert.Equal(t, c.Len(), 0)
+
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, info.Size(), int64(0))
+	})
+}
+
+func TestDiskCacheRecovers(t *testing.T) {
+	withDiskPath(t, func(path string) {
+		c, err := NewDisk(path, DiskOptions{Codec: JSONCodec, Sync: true})
+		assert.Nil(t, err)
+
+		c.Add("k1", "v1")
+		c.Add("k2", "v2")
+		c.Add("k3", "v3")
+		c.Remove("k2")
+		c.Add("k1", "v1-again")
+		assert.Nil(t, c.Close())
+
+		// simulate a torn write
+		size := c.(*diskCache).size
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		assert.Nil(t, err)
+		f.Write([]byte{0, 0, 0, 100, 1, 2, 3, 4, '{'})
+		f.Close()
+
+		c, err = NewDisk(path, DiskOptions{Codec: JSONCodec})
+		assert.Nil(t, err)
+		defer c.Close()
+
+		assert.Equal(t, c.(*diskCache).size, size)
+		assert.Equal(t, c.Len(), 2)
+		assert.ArrayEqual(t, keys(c), []interface{}{"k3", "k1"})
+
+		v, ok := c.Get("k1")
+		assert.True(t, ok)
+		assert.Equal(t, v, "v1-again")
+
+		_, ok = c.Get("k2")
+		assert.False(t, ok)
+
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, info.Size(), size)
+	})
+}
+
+func TestDiskCacheMaxEntries(t *testing.T) {
+	withDiskPath(t, func(path string) {
+		c, err := NewDisk(path, DiskOptions{MaxEntries: 2})
+		assert.Nil(t, err)
+		defer c.Close()
+
+		c.Add("k1", "v1")
+		c.Add("k2", "v2")
+		c.Get("k1")
+		c.Add("k3", "v3")
+
+		assert.ArrayEqual(t, keys(c), []interface{}{"k1", "k3"})
+		assert.Nil(t, c.Close())
+
+		c, err = NewDisk(path, DiskOptions{MaxEntries: 2})
+		assert.Nil(t, err)
+		defer c.Close()
+
+		assert.ArrayEqual(t, keys(c), []interface{}{"k1", "k3"})
+	})
+}
+
+func TestDiskCacheRecoverRejectsOversizedRecords(t *testing.T) {
+	withDiskPath(t, func(path string) {
+		c, err := NewDisk(path, DiskOptions{})
+		assert.Nil(t, err)
+		c.Add("k1", "v1")
+		assert.Nil(t, c.Close())
+		size := c.(*diskCache).size
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		assert.Nil(t, err)
+		f.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4, 5})
+		f.Close()
+
+		c, err = NewDisk(path, DiskOptions{})
+		assert.Nil(t, err)
+		defer c.Close()
+
+		assert.Equal(t, c.(*diskCache).size, size)
+		assert.ArrayEqual(t, keys(c), []interface{}{"k1"})
+	})
+}
+
+func TestDiskCacheCompaction(t *testing.T) {
+	withDiskPath(t, func(path string) {
+		c, err := NewDisk(path, DiskOptions{CompactSize: 1024})
+		assert.Nil(t, err)
+		defer c.Close()
+
+		impl := c.(*diskCache)
+		for i := 0; i < 100; i++ {
+			c.Add("k1", i)
+			c.Add("k2", -i)
+			assert.True(t, impl.size <= 2*impl.live || impl.size <= 1024)
+		}
+
+		v, ok := c.Get("k1")
+		assert.True(t, ok)
+		assert.Equal(t, v, 99)
+
+		assert.Nil(t, c.Compact())
+		assert.Equal(t, impl.size, impl.live)
+		assert.ArrayEqual(t, keys(c), []interface{}{"k2", "k1"})
+
+		v, ok = c.Get("k2")
+		assert.True(t, ok)
+		assert.Equal(t, v, -99)
+
+		_, err = os.Stat(path + ".compact")
+		assert.True(t, os.IsNotExist(err))
+
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, info.Size(), impl.size)
+	})
+}
+
+func TestDiskCacheReportsErrors(t *testing.T) {
+	withDiskPath(t, func(path string) {
+		var errs []error
+		c, err := NewDisk(path, DiskOptions{OnError: func(err error) { errs = append(errs, err) }})
+		assert.Nil(t, err)
+
+		c.Add("k1", "v1")
+		c.Close()
+
+		_, ok := c.Get("k1")
+		assert.False(t, ok)
+		assert.False(t, c.Add("k2", "v2"))
+		assert.Equal(t, len(errs), 2)
+	})
+}
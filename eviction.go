@@ -0,0 +1,52 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+// EvictionHook is invoked with the key and value of an entry evicted from a Cache
+// to make room for another entry.
+type EvictionHook func(key, value interface{})
+
+// EvictionNotifier is implemented by Caches that report evictions. Caches
+// created by NewLRU, NewTTL and NewGDSF implement EvictionNotifier.
+type EvictionNotifier interface {
+	// AddEvictionHook registers h to be invoked for each live entry evicted to
+	// stay within the Cache's size. Entries that are removed, cleared or expired
+	// are not reported. Hooks are invoked after the Cache's lock is released, so
+	// they may safely call back into the Cache.
+	AddEvictionHook(h EvictionHook)
+}
+
+type evictedEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// evictionHooks is a copy-on-write list of EvictionHooks, allowing a copy taken
+// while holding a Cache's lock to be used after the lock is released.
+type evictionHooks []EvictionHook
+
+func (h evictionHooks) add(hook EvictionHook) evictionHooks {
+	return append(h[:len(h):len(h)], hook)
+}
+
+func (h evictionHooks) notify(evicted []evictedEntry) {
+	for _, e := range evicted {
+		for _, hook := range h {
+			hook(e.key, e.value)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+)
+
+// CostCache is a Cache whose entries have a cost to recompute and a size.
+type CostCache interface {
+	Cache
+	EvictionNotifier
+
+	// AddWithCost adds an item to the cache with the given miss cost and size.
+	// Sizes less than 1 are treated as 1 and negative costs as 0. An item larger
+	// than the cache's capacity is not added, though any existing item for key is
+	// removed. Returns true if the key already existed.
+	AddWithCost(key, value interface{}, cost float64, size int64) bool
+
+	// Size returns the total size of the items in the cache.
+	Size() int64
+}
+
+// NewGDSF creates a CostCache that holds items with a total size of at most
+// capacity, evicting by GreedyDual-Size-Frequency. Each item's priority is the
+// cache's inflation value plus the item's hit count times its cost divided by
+// its size. When room must be made, the item with the lowest priority is
+// evicted, ties going to the least recently used, and the inflation value is
+// raised to the evicted item's priority, so that items which are not hit again
+// eventually become eligible for eviction however costly they are. Add is
+// equivalent to AddWithCost with a cost and size of 1.
+func NewGDSF(capacity int64) (CostCache, error) {
+	if capacity <= 0 {
+		return nil, errors.New("Must provide a positive capacity")
+	}
+
+	return &gdsf{
+		capacity: capacity,
+		lookup:   map[interface{}]*gdsfEntry{},
+	}, nil
+}
+
+type gdsf struct {
+	capacity  int64
+	size      int64
+	inflation float64
+	clock     uint64
+	lookup    map[interface{}]*gdsfEntry
+	entries   gdsfEntries
+	hooks     evictionHooks
+	lock      sync.Mutex
+}
+
+type gdsfEntry struct {
+	key      interface{}
+	value    interface{}
+	cost     float64
+	size     int64
+	hits     int
+	priority float64
+	used     uint64
+	idx      int
+}
+
+// gdsfEntries is a min-heap of entries ordered by priority and then by when they
+// were last used.
+type gdsfEntries []*gdsfEntry
+
+func (h gdsfEntries) Len() int { return len(h) }
+
+func (h gdsfEntries) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+	return h[i].used < h[j].used
+}
+
+func (h gdsfEntries) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].idx = i
+	h[j].idx = j
+}
+
+func (h *gdsfEntries) Push(x interface{}) {
+	e := x.(*gdsfEntry)
+	e.idx = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *gdsfEntries) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// touch records a hit on e and recomputes its priority.
+func (c *gdsf) touch(e *gdsfEntry) {
+	e.hits++
+	e.priority = c.inflation + float64(e.hits)*e.cost/float64(e.size)
+	c.clock++
+	e.used = c.clock
+}
+
+func (c *gdsf) remove(e *gdsfEntry) {
+	heap.Remove(&c.entries, e.idx)
+	delete(c.lookup, e.key)
+	c.size -= e.size
+}
+
+// evict removes the lowest priority entries until size more fits, raising the
+// inflation value to the priority of the last entry evicted.
+func (c *gdsf) evict(size int64) []evictedEntry {
+	var evicted []evictedEntry
+	for c.size+size > c.capacity && len(c.entries) > 0 {
+		e := c.entries[0]
+		c.inflation = e.priority
+		c.remove(e)
+		evicted = append(evicted, evictedEntry{e.key, e.value})
+	}
+
+	return evicted
+}
+
+func (c *gdsf) Get(key interface{}) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.lookup[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.touch(e)
+	heap.Fix(&c.entries, e.idx)
+	return e.value, true
+}
+
+func (c *gdsf) ForEach(f func(key, value interface{})) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, e := range c.entries {
+		f(e.key, e.value)
+	}
+}
+
+func (c *gdsf) Add(key, value interface{}) bool {
+	return c.AddWithCost(key, value, 1, 1)
+}
+
+func (c *gdsf) AddWithCost(key, value interface{}, cost float64, size int64) bool {
+	if size < 1 {
+		size = 1
+	}
+
+	if cost < 0 {
+		cost = 0
+	}
+
+	c.lock.Lock()
+
+	// A replaced entry keeps its hit count, but not its place in the cache.
+	hits := 0
+	old, existed := c.lookup[key]
+	if existed {
+		hits = old.hits
+		c.remove(old)
+	}
+
+	var evicted []evictedEntry
+	if size <= c.capacity {
+		evicted = c.evict(size)
+
+		e := &gdsfEntry{key: key, value: value, cost: cost, size: size, hits: hits}
+		c.touch(e)
+		heap.Push(&c.entries, e)
+		c.lookup[key] = e
+		c.size += size
+	}
+
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return existed
+}
+
+func (c *gdsf) AddEvictionHook(h EvictionHook) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.hooks = c.hooks.add(h)
+}
+
+func (c *gdsf) Remove(key interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.lookup[key]
+	if ok {
+		c.remove(e)
+	}
+
+	return ok
+}
+
+func (c *gdsf) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lookup = map[interface{}]*gdsfEntry{}
+	c.entries = nil
+	c.size = 0
+	c.inflation = 0
+}
+
+func (c *gdsf) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.entries)
+}
+
+func (c *gdsf) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.size
+}
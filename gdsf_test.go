@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewGDSF(t *testing.T) {
+	c, err := NewGDSF(0)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "capacity")
+
+	c, err = NewGDSF(1)
+	assert.NonNil(t, c)
+	assert.Nil(t, err)
+}
+
+func TestGDSFEvictsByCostAndSize(t *testing.T) {
+	c, _ := NewGDSF(10)
+
+	evicted := []interface{}{}
+	c.AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	assert.False(t, c.AddWithCost("cheap", 1, 1, 5))
+	assert.False(t, c.AddWithCost("pricey", 2, 100, 5))
+	assert.Equal(t, c.Size(), int64(10))
+
+	c.Add("x", 3)
+	assert.ArrayEqual(t, evicted, []interface{}{"cheap"})
+
+	// Frequently used entries are kept over less frequently used ones.
+	c.Add("y", 4)
+	c.Get("x")
+	c.AddWithCost("big", 5, 1, 4)
+	assert.ArrayEqual(t, evicted, []interface{}{"cheap", "y"})
+	assert.HasSameElements(t, keys(c), []interface{}{"pricey", "x", "big"})
+	assert.Equal(t, c.Size(), int64(10))
+	assert.Equal(t, c.Len(), 3)
+
+	v, ok := c.Get("pricey")
+	assert.True(t, ok)
+	assert.Equal(t, v, 2)
+}
+
+func TestGDSFAging(t *testing.T) {
+	c, _ := NewGDSF(2)
+
+	c.AddWithCost("pricey", 1, 10, 1)
+	for i := 0; i < 11; i++ {
+		c.Add(i, i)
+	}
+
+	_, ok := c.Get("pricey")
+	assert.False(t, ok)
+	assert.Equal(t, c.Len(), 2)
+}
+
+func TestGDSFReplace(t *testing.T) {
+	c, _ := NewGDSF(3)
+
+	c.Add("a", 1)
+	c.Get("a")
+	c.Add("b", 2)
+	c.Add("c", 3)
+
+	// Replacing an entry retains its hits.
+	assert.True(t, c.Add("a", 4))
+	c.Add("d", 5)
+	assert.HasSameElements(t, keys(c), []interface{}{"a", "c", "d"})
+
+	// An entry too large to fit removes the entry it would replace.
+	assert.True(t, c.AddWithCost("a", 6, 1, 4))
+	assert.HasSameElements(t, keys(c), []interface{}{"c", "d"})
+	assert.Equal(t, c.Size(), int64(2))
+
+	assert.True(t, c.Remove("c"))
+	assert.False(t, c.Remove("c"))
+	assert.Equal(t, c.Size(), int64(1))
+
+	c.Clear()
+	assert.Equal(t, c.Len(), 0)
+	assert.Equal(t, c.Size(), int64(0))
+	assert.Equal(t, c.(*gdsf).inflation, 0.0)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"time"
+)
+
+// EntryInfo is an entry in a Cache and its metadata.
+type EntryInfo struct {
+	Value interface{}
+
+	// Added is when the entry's value was last written.
+	Added time.Time
+
+	// Deadline is when the entry expires. It is zero if the entry does not
+	// expire.
+	Deadline time.Time
+
+	// TTL is the time remaining until Deadline. It is zero if the entry does
+	// not expire.
+	TTL time.Duration
+
+	// Accesses is the number of times the entry was retrieved since it was
+	// last written.
+	Accesses int
+
+	// LastAccess is when the entry was last retrieved. It is zero if the entry
+	// has not been retrieved since it was last written.
+	LastAccess time.Time
+}
+
+// InspectableCache is implemented by Caches whose entries may be examined without
+// affecting eviction ordering. Caches created by NewLRU and NewTTL implement
+// InspectableCache. None of its methods mark keys as recently used or count as
+// accesses.
+type InspectableCache interface {
+	Cache
+
+	// Peek retrieves an item from the cache, like Get.
+	Peek(key interface{}) (interface{}, bool)
+
+	// Contains returns true if the key is present.
+	Contains(key interface{}) bool
+
+	// GetEntry retrieves an item from the cache with its metadata.
+	GetEntry(key interface{}) (EntryInfo, bool)
+}
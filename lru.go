@@ -17,9 +17,13 @@ limitations under the License.
 package cache
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/golang-lru/simplelru"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
 )
 
 // NewLRU creates a new, thread-safe LRU cache with a maximum size. When adding a key
@@ -28,24 +32,156 @@ import (
 // as the most recently used key. Invocations of ForEach do not modify eviction
 // ordering.
 func NewLRU(size int) (Cache, error) {
-	underlying, err := simplelru.NewLRU(size, nil)
+	return NewLRUWithOptions(size, LRUOptions{})
+}
+
+// LRUOptions configures optional behavior of a Cache created by
+// NewLRUWithOptions.
+type LRUOptions struct {
+	// MaxPinned limits the number of pinned entries. If zero, up to the
+	// cache's size may be pinned.
+	MaxPinned int
+}
+
+// NewLRUWithOptions creates a new LRU cache with a maximum size, as NewLRU does,
+// with additional behavior configured by opts.
+func NewLRUWithOptions(size int, opts LRUOptions) (Cache, error) {
+	if opts.MaxPinned < 0 {
+		return nil, errors.New("Must provide a non-negative maximum number of pinned entries")
+	}
+
+	c := &lruCache{
+		size:       size,
+		retention:  retentionCounts{maxPinned: opts.MaxPinned},
+		tags:       newTagIndex(),
+		timeSource: tbntime.NewSource(),
+	}
+
+	underlying, err := simplelru.NewLRU(size, c.onEvict)
 	if err != nil {
 		return nil, err
 	}
+	c.lru = underlying
 
-	return &lruCache{lru: underlying}, nil
+	return c, nil
 }
 
 type lruCache struct {
-	lru  *simplelru.LRU
-	lock sync.RWMutex
+	lru        *simplelru.LRU
+	size       int
+	retention  retentionCounts
+	hooks      evictionHooks
+	tags       *tagIndex
+	prefixes   *keyTrie
+	timeSource tbntime.Source
+	lock       sync.RWMutex
+}
+
+// lruEntry is a value in an lruCache and its metadata.
+type lruEntry struct {
+	value      interface{}
+	added      time.Time
+	accesses   int
+	lastAccess time.Time
+	retention
+}
+
+// onEvict keeps the cache's indexes and pinned count consistent with the contents
+// of the LRU.
+func (c *lruCache) onEvict(key, value interface{}) {
+	c.tags.remove(key)
+	c.prefixes.removeKey(key)
+	c.retention.forget(&value.(*lruEntry).retention)
+}
+
+// put stores value for key, which must already be present or have room. The
+// entry keeps its pin and priority, if any; add then sets the priority it is
+// given, while other writes retain it.
+func (c *lruCache) put(key, value interface{}) *lruEntry {
+	e := &lruEntry{value: value, added: c.timeSource.Now()}
+	if old, ok := c.peek(key); ok {
+		e.retention = old.retention
+	}
+
+	c.lru.Add(key, e)
+	return e
+}
+
+// evictOldest removes the entry chosen by retentionCounts.victim. Returns false if
+// every entry is pinned.
+func (c *lruCache) evictOldest() (evictedEntry, bool) {
+	key, ok := c.retention.victim(c.lru)
+	if !ok {
+		return evictedEntry{}, false
+	}
+
+	e, _ := c.peek(key)
+	c.lru.Remove(key)
+	return evictedEntry{key, e.value}, true
+}
+
+func (c *lruCache) peek(key interface{}) (*lruEntry, bool) {
+	if v, ok := c.lru.Peek(key); ok {
+		return v.(*lruEntry), true
+	}
+
+	return nil, false
+}
+
+// get returns the value for key, marking it as the most recently used and
+// recording the access.
+func (c *lruCache) get(key interface{}) (interface{}, bool) {
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(*lruEntry)
+	e.accesses++
+	e.lastAccess = c.timeSource.Now()
+	return e.value, true
 }
 
 func (c *lruCache) Get(key interface{}) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.get(key)
+}
+
+func (c *lruCache) Peek(key interface{}) (interface{}, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if e, ok := c.peek(key); ok {
+		return e.value, true
+	}
+
+	return nil, false
+}
+
+func (c *lruCache) Contains(key interface{}) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.lru.Contains(key)
+}
+
+func (c *lruCache) GetEntry(key interface{}) (EntryInfo, bool) {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
-	return c.lru.Get(key)
+	e, ok := c.peek(key)
+	if !ok {
+		return EntryInfo{}, false
+	}
+
+	return EntryInfo{
+		Value:      e.value,
+		Added:      e.added,
+		Accesses:   e.accesses,
+		LastAccess: e.lastAccess,
+	}, true
 }
 
 // ForEach iterates over the key-value pairs in the Cache from least to most recently
@@ -55,20 +191,283 @@ func (c *lruCache) ForEach(f func(key, value interface{})) {
 	defer c.lock.RUnlock()
 
 	for _, key := range c.lru.Keys() {
-		value, _ := c.lru.Peek(key)
-		f(key, value)
+		e, _ := c.peek(key)
+		f(key, e.value)
 	}
 }
 
+func (c *lruCache) Range(f func(key, value interface{}) bool) {
+	c.RangeWithOptions(RangeOptions{}, f)
+}
+
+func (c *lruCache) RangeWithOptions(opts RangeOptions, f func(key, value interface{}) bool) {
+	c.lock.RLock()
+	keys := c.lru.Keys()
+	entries := make([]KeyValue, len(keys))
+	for i, key := range keys {
+		e, _ := c.peek(key)
+		entries[i] = KeyValue{key, e.value}
+	}
+
+	if opts.Order == NewestFirst {
+		reverseEntries(entries)
+	}
+
+	if opts.Snapshot {
+		c.lock.RUnlock()
+	} else {
+		defer c.lock.RUnlock()
+	}
+
+	rangeEntries(entries, f)
+}
+
 func (c *lruCache) Add(key, value interface{}) bool {
+	return c.AddTagged(key, value)
+}
+
+func (c *lruCache) AddTagged(key, value interface{}, tags ...string) bool {
 	c.lock.Lock()
-	defer c.lock.Unlock()
+	existed, evicted, _ := c.add(key, value, tags, DefaultPriority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return existed
+}
 
+// add stores value for key with the given tags and priority, evicting an entry if
+// necessary. Returns whether key was present and the evicted entry, if any, or
+// ErrAllPinned if no entry could be evicted.
+func (c *lruCache) add(
+	key, value interface{},
+	tags []string,
+	priority int,
+) (bool, []evictedEntry, error) {
 	existed := c.lru.Contains(key)
-	c.lru.Add(key, value)
+
+	var evicted []evictedEntry
+	if !existed && c.lru.Len() >= c.size {
+		e, ok := c.evictOldest()
+		if !ok {
+			return false, nil, ErrAllPinned
+		}
+		evicted = append(evicted, e)
+	}
+
+	c.retention.setPriority(&c.put(key, value).retention, priority)
+	c.tags.set(key, tags)
+	c.prefixes.insertKey(key)
+	return existed, evicted, nil
+}
+
+func (c *lruCache) AddWithPriority(key, value interface{}, priority int) (bool, error) {
+	c.lock.Lock()
+	existed, evicted, err := c.add(key, value, nil, priority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return existed, err
+}
+
+func (c *lruCache) TryAdd(key, value interface{}) (bool, error) {
+	c.lock.Lock()
+	existed, evicted, err := c.add(key, value, nil, DefaultPriority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return existed, err
+}
+
+func (c *lruCache) AddPinned(key, value interface{}) error {
+	c.lock.Lock()
+	if e, ok := c.peek(key); !c.retention.canPin(ok && e.pinned, c.size) {
+		c.lock.Unlock()
+		return ErrPinLimit
+	}
+
+	_, evicted, err := c.add(key, value, nil, DefaultPriority)
+	if err == nil {
+		e, _ := c.peek(key)
+		c.retention.pin(&e.retention)
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return err
+}
+
+func (c *lruCache) Pin(key interface{}) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.peek(key)
+	switch {
+	case !ok:
+		return false, nil
+	case !c.retention.canPin(e.pinned, c.size):
+		return true, ErrPinLimit
+	}
+
+	c.retention.pin(&e.retention)
+	return true, nil
+}
+
+func (c *lruCache) Unpin(key interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.peek(key)
+	return ok && c.retention.unpin(&e.retention)
+}
+
+func (c *lruCache) AddIfAbsent(key, value interface{}) bool {
+	c.lock.Lock()
+	if c.lru.Contains(key) {
+		c.lock.Unlock()
+		return false
+	}
+
+	_, evicted, err := c.add(key, value, nil, DefaultPriority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return err == nil
+}
+
+func (c *lruCache) Replace(key, value interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.lru.Contains(key) {
+		return false
+	}
+
+	c.put(key, value)
+	return true
+}
+
+func (c *lruCache) CompareAndSwap(key, old, new interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.peek(key); !ok || !equalValues(e.value, old) {
+		return false
+	}
+
+	c.put(key, new)
+	return true
+}
+
+func (c *lruCache) Compute(
+	key interface{},
+	f func(old interface{}, exists bool) (interface{}, bool),
+) (interface{}, bool) {
+	c.lock.Lock()
+	var old interface{}
+	e, exists := c.peek(key)
+	if exists {
+		old = e.value
+	}
+	value, keep := f(old, exists)
+
+	var (
+		evicted []evictedEntry
+		err     error
+	)
+	switch {
+	case !keep:
+		c.lru.Remove(key)
+	case exists:
+		c.put(key, value)
+	default:
+		_, evicted, err = c.add(key, value, nil, DefaultPriority)
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return value, keep && err == nil
+}
+
+func (c *lruCache) GetMulti(keys []interface{}) ([]interface{}, []bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	values := make([]interface{}, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		values[i], found[i] = c.get(key)
+	}
+
+	return values, found
+}
+
+func (c *lruCache) AddMulti(entries []KeyValue) []bool {
+	c.lock.Lock()
+	existed := make([]bool, len(entries))
+	var evicted []evictedEntry
+	for i, e := range entries {
+		var ev []evictedEntry
+		existed[i], ev, _ = c.add(e.Key, e.Value, nil, DefaultPriority)
+		evicted = append(evicted, ev...)
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
 	return existed
 }
 
+func (c *lruCache) RemoveMulti(keys []interface{}) []bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	removed := make([]bool, len(keys))
+	for i, key := range keys {
+		removed[i] = c.lru.Remove(key)
+	}
+
+	return removed
+}
+
+func (c *lruCache) Resize(size int) error {
+	if size <= 0 {
+		return errors.New("Must provide a positive size")
+	}
+
+	c.lock.Lock()
+	if size < c.retention.pinned {
+		c.lock.Unlock()
+		return ErrAllPinned
+	}
+
+	var evicted []evictedEntry
+	for c.lru.Len() > size {
+		e, _ := c.evictOldest()
+		evicted = append(evicted, e)
+	}
+
+	c.lru = resizeLRU(c.lru, size, c.onEvict)
+	c.size = size
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return nil
+}
+
+func (c *lruCache) AddEvictionHook(h EvictionHook) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.hooks = c.hooks.add(h)
+}
+
 func (c *lruCache) Remove(key interface{}) bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -76,6 +475,51 @@ func (c *lruCache) Remove(key interface{}) bool {
 	return c.lru.Remove(key)
 }
 
+func (c *lruCache) InvalidateTag(tag string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keys := c.tags.keys(tag)
+	for _, key := range keys {
+		c.lru.Remove(key)
+	}
+
+	return len(keys)
+}
+
+func (c *lruCache) RemoveIf(pred func(key, value interface{}) bool) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	n := 0
+	for _, key := range c.lru.Keys() {
+		if e, _ := c.peek(key); pred(key, e.value) {
+			c.lru.Remove(key)
+			n++
+		}
+	}
+
+	return n
+}
+
+func (c *lruCache) RemovePrefix(prefix string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	index := indexKeys(&c.prefixes, func(f func(key interface{})) {
+		for _, key := range c.lru.Keys() {
+			f(key)
+		}
+	})
+
+	keys := index.withPrefix(prefix)
+	for _, key := range keys {
+		c.lru.Remove(key)
+	}
+
+	return len(keys)
+}
+
 func (c *lruCache) Clear() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -89,3 +533,31 @@ func (c *lruCache) Len() int {
 
 	return c.lru.Len()
 }
+
+func (c *lruCache) snapshot() []snapshotEntry {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	keys := c.lru.Keys()
+	entries := make([]snapshotEntry, 0, len(keys))
+	for _, key := range keys {
+		e, _ := c.peek(key)
+		entries = append(entries, snapshotEntry{Key: key, Value: e.value})
+	}
+
+	return entries
+}
+
+func (c *lruCache) restore(entries []snapshotEntry) {
+	c.lock.Lock()
+	var evicted []evictedEntry
+	for _, e := range entries {
+		if _, ev, err := c.add(e.Key, e.Value, nil, DefaultPriority); err == nil {
+			evicted = append(evicted, ev...)
+		}
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+}
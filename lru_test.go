@@ -18,7 +18,9 @@ package cache
 
 import (
 	"testing"
+	"time"
 
+	tbntime "github.com/turbinelabs/nonstdlib/time"
 	"github.com/turbinelabs/test/assert"
 )
 
@@ -31,6 +33,7 @@ func TestNewLRU(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NonNil(t, c)
 	assert.NonNil(t, c.(*lruCache).lru)
+	assert.NonNil(t, c.(*lruCache).timeSource)
 }
 
 func TestLRUCacheBasicOperations(t *testing.T) {
@@ -97,3 +100,205 @@ func TestLRUCacheForEach(t *testing.T) {
 		{"k1", "v1"},
 	})
 }
+
+func TestLRUCacheEvictionHook(t *testing.T) {
+	c, err := NewLRU(2)
+	assert.Nil(t, err)
+
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, v interface{}) {
+		// hooks may call back into the cache
+		assert.False(t, c.Remove(k))
+		evicted = append(evicted, k, v)
+	})
+
+	c.Add("k1", "v1")
+	c.Add("k2", "v2")
+	c.Add("k1", "v1-again")
+	c.Remove("k2")
+	c.Add("k3", "v3")
+	assert.Equal(t, len(evicted), 0)
+
+	c.Add("k4", "v4")
+	assert.ArrayEqual(t, evicted, []interface{}{"k1", "v1-again"})
+
+	c.Clear()
+	assert.Equal(t, len(evicted), 2)
+}
+
+func TestLRUCacheRemoveIf(t *testing.T) {
+	c, _ := NewLRU(10)
+	for i := 0; i < 6; i++ {
+		c.Add(i, i*10)
+	}
+
+	n := c.(BulkRemover).RemoveIf(func(k, v interface{}) bool {
+		return k.(int)%2 == 0 || v.(int) == 50
+	})
+	assert.Equal(t, n, 4)
+	assert.ArrayEqual(t, keys(c), []interface{}{1, 3})
+}
+
+func TestLRUCacheRemovePrefix(t *testing.T) {
+	c, _ := NewLRU(3)
+	c.Add("user/1", 1)
+	c.Add("user/2", 2)
+	c.Add(3, 3)
+	c.Add("group/1", 4)
+	assert.Nil(t, c.(*lruCache).prefixes)
+
+	assert.Equal(t, c.(BulkRemover).RemovePrefix("user/"), 1)
+	assert.ArrayEqual(t, keys(c), []interface{}{3, "group/1"})
+	assert.Equal(t, c.(BulkRemover).RemovePrefix("user/"), 0)
+
+	// Once built, the index is maintained.
+	c.Add("user/3", 5)
+	assert.Equal(t, c.(BulkRemover).RemovePrefix("user/"), 1)
+
+	c.Clear()
+	assert.Equal(t, c.(BulkRemover).RemovePrefix(""), 0)
+}
+
+func TestLRUCacheMulti(t *testing.T) {
+	c, _ := NewLRU(3)
+	mc := c.(MultiCache)
+
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	existed := mc.AddMulti([]KeyValue{{"a", 1}, {"b", 2}, {"a", 3}, {"c", 4}, {"d", 5}})
+	assert.ArrayEqual(t, existed, []bool{false, false, true, false, false})
+	assert.ArrayEqual(t, evicted, []interface{}{"b"})
+
+	values, found := mc.GetMulti([]interface{}{"a", "b", "c"})
+	assert.ArrayEqual(t, values, []interface{}{3, nil, 4})
+	assert.ArrayEqual(t, found, []bool{true, false, true})
+	assert.ArrayEqual(t, keys(c), []interface{}{"d", "a", "c"})
+
+	assert.ArrayEqual(t, mc.RemoveMulti([]interface{}{"a", "b", "d"}), []bool{true, false, true})
+	assert.ArrayEqual(t, keys(c), []interface{}{"c"})
+}
+
+func TestLRUCacheInspect(t *testing.T) {
+	c, _ := NewLRU(2)
+	ic := c.(InspectableCache)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*lruCache).timeSource = ts
+		start := ts.Now()
+
+		c.Add("a", 1)
+		c.Add("b", 2)
+
+		v, ok := ic.Peek("a")
+		assert.True(t, ok)
+		assert.Equal(t, v, 1)
+		assert.True(t, ic.Contains("a"))
+		assert.False(t, ic.Contains("c"))
+		_, ok = ic.Peek("c")
+		assert.False(t, ok)
+
+		info, ok := ic.GetEntry("a")
+		assert.True(t, ok)
+		assert.DeepEqual(t, info, EntryInfo{Value: 1, Added: start})
+
+		// Inspection does not affect eviction order.
+		c.Add("c", 3)
+		assert.False(t, ic.Contains("a"))
+		_, ok = ic.GetEntry("a")
+		assert.False(t, ok)
+
+		ts.Advance(time.Second)
+		c.Get("b")
+		ts.Advance(time.Second)
+		c.Get("b")
+
+		info, _ = ic.GetEntry("b")
+		assert.DeepEqual(t, info, EntryInfo{
+			Value:      2,
+			Added:      start,
+			Accesses:   2,
+			LastAccess: start.Add(2 * time.Second),
+		})
+
+		c.Add("b", 4)
+		info, _ = ic.GetEntry("b")
+		assert.DeepEqual(t, info, EntryInfo{Value: 4, Added: start.Add(2 * time.Second)})
+	})
+}
+
+func TestLRUCacheResize(t *testing.T) {
+	c, _ := NewLRU(4)
+	r := c.(Resizable)
+
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Add(k, k)
+	}
+	c.Get("a")
+	assert.Equal(t, c.(*lruCache).RemovePrefix("z"), 0)
+
+	assert.ErrorContains(t, r.Resize(0), "positive size")
+	assert.Equal(t, c.(*lruCache).size, 4)
+
+	assert.Nil(t, r.Resize(2))
+	assert.Equal(t, c.(*lruCache).size, 2)
+	assert.ArrayEqual(t, evicted, []interface{}{"b", "c"})
+	assert.ArrayEqual(t, keys(c), []interface{}{"d", "a"})
+	assert.ArrayEqual(t, c.(*lruCache).prefixes.withPrefix(""), []string{"a", "d"})
+
+	assert.Nil(t, r.Resize(3))
+	c.Add("e", "e")
+	assert.ArrayEqual(t, keys(c), []interface{}{"d", "a", "e"})
+	c.Add("f", "f")
+	assert.ArrayEqual(t, keys(c), []interface{}{"a", "e", "f"})
+	assert.ArrayEqual(t, evicted, []interface{}{"b", "c", "d"})
+}
+
+func TestLRUCacheRange(t *testing.T) {
+	c, _ := NewLRU(5)
+	r := c.(Ranger)
+
+	for i := 0; i < 5; i++ {
+		c.Add(i, i*10)
+	}
+	c.Get(0)
+
+	visit := func(limit int) (func(k, v interface{}) bool, *[]interface{}) {
+		visited := []interface{}{}
+		return func(k, v interface{}) bool {
+			assert.Equal(t, v, k.(int)*10)
+			visited = append(visited, k)
+			return len(visited) < limit
+		}, &visited
+	}
+
+	f, visited := visit(10)
+	r.Range(f)
+	assert.ArrayEqual(t, *visited, []interface{}{1, 2, 3, 4, 0})
+
+	f, visited = visit(2)
+	r.Range(f)
+	assert.ArrayEqual(t, *visited, []interface{}{1, 2})
+
+	f, visited = visit(3)
+	r.RangeWithOptions(RangeOptions{Order: NewestFirst}, f)
+	assert.ArrayEqual(t, *visited, []interface{}{0, 4, 3})
+
+	f, visited = visit(10)
+	r.RangeWithOptions(RangeOptions{Order: ExpiringFirst}, f)
+	assert.ArrayEqual(t, *visited, []interface{}{1, 2, 3, 4, 0})
+
+	// Snapshots allow the callback to modify the cache.
+	r.RangeWithOptions(RangeOptions{Snapshot: true}, func(k, _ interface{}) bool {
+		c.Remove(k)
+		return k != 3
+	})
+	assert.ArrayEqual(t, keys(c), []interface{}{4, 0})
+}
@@ -99,3 +99,132 @@ func (m *MockCache) Len() int {
 func (mr *MockCacheMockRecorder) Len() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockCache)(nil).Len))
 }
+
+// MockMultiCache is a mock of MultiCache interface
+type MockMultiCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockMultiCacheMockRecorder
+}
+
+// MockMultiCacheMockRecorder is the mock recorder for MockMultiCache
+type MockMultiCacheMockRecorder struct {
+	mock *MockMultiCache
+}
+
+// NewMockMultiCache creates a new mock instance
+func NewMockMultiCache(ctrl *gomock.Controller) *MockMultiCache {
+	mock := &MockMultiCache{ctrl: ctrl}
+	mock.recorder = &MockMultiCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockMultiCache) EXPECT() *MockMultiCacheMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method
+func (m *MockMultiCache) Get(key interface{}) (interface{}, bool) {
+	ret := m.ctrl.Call(m, "Get", key)
+	ret0, _ := ret[0].(interface{})
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockMultiCacheMockRecorder) Get(key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockMultiCache)(nil).Get), key)
+}
+
+// ForEach mocks base method
+func (m *MockMultiCache) ForEach(f func(interface{}, interface{})) {
+	m.ctrl.Call(m, "ForEach", f)
+}
+
+// ForEach indicates an expected call of ForEach
+func (mr *MockMultiCacheMockRecorder) ForEach(f interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForEach", reflect.TypeOf((*MockMultiCache)(nil).ForEach), f)
+}
+
+// Add mocks base method
+func (m *MockMultiCache) Add(key, value interface{}) bool {
+	ret := m.ctrl.Call(m, "Add", key, value)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Add indicates an expected call of Add
+func (mr *MockMultiCacheMockRecorder) Add(key, value interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockMultiCache)(nil).Add), key, value)
+}
+
+// Remove mocks base method
+func (m *MockMultiCache) Remove(key interface{}) bool {
+	ret := m.ctrl.Call(m, "Remove", key)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Remove indicates an expected call of Remove
+func (mr *MockMultiCacheMockRecorder) Remove(key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockMultiCache)(nil).Remove), key)
+}
+
+// Clear mocks base method
+func (m *MockMultiCache) Clear() {
+	m.ctrl.Call(m, "Clear")
+}
+
+// Clear indicates an expected call of Clear
+func (mr *MockMultiCacheMockRecorder) Clear() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clear", reflect.TypeOf((*MockMultiCache)(nil).Clear))
+}
+
+// Len mocks base method
+func (m *MockMultiCache) Len() int {
+	ret := m.ctrl.Call(m, "Len")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Len indicates an expected call of Len
+func (mr *MockMultiCacheMockRecorder) Len() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockMultiCache)(nil).Len))
+}
+
+// GetMulti mocks base method
+func (m *MockMultiCache) GetMulti(keys []interface{}) ([]interface{}, []bool) {
+	ret := m.ctrl.Call(m, "GetMulti", keys)
+	ret0, _ := ret[0].([]interface{})
+	ret1, _ := ret[1].([]bool)
+	return ret0, ret1
+}
+
+// GetMulti indicates an expected call of GetMulti
+func (mr *MockMultiCacheMockRecorder) GetMulti(keys interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMulti", reflect.TypeOf((*MockMultiCache)(nil).GetMulti), keys)
+}
+
+// AddMulti mocks base method
+func (m *MockMultiCache) AddMulti(entries []KeyValue) []bool {
+	ret := m.ctrl.Call(m, "AddMulti", entries)
+	ret0, _ := ret[0].([]bool)
+	return ret0
+}
+
+// AddMulti indicates an expected call of AddMulti
+func (mr *MockMultiCacheMockRecorder) AddMulti(entries interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMulti", reflect.TypeOf((*MockMultiCache)(nil).AddMulti), entries)
+}
+
+// RemoveMulti mocks base method
+func (m *MockMultiCache) RemoveMulti(keys []interface{}) []bool {
+	ret := m.ctrl.Call(m, "RemoveMulti", keys)
+	ret0, _ := ret[0].([]bool)
+	return ret0
+}
+
+// RemoveMulti indicates an expected call of RemoveMulti
+func (mr *MockMultiCacheMockRecorder) RemoveMulti(keys interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMulti", reflect.TypeOf((*MockMultiCache)(nil).RemoveMulti), keys)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+)
+
+var (
+	// ErrAllPinned is returned when an entry cannot be added to a full Cache
+	// because every entry in it is pinned.
+	ErrAllPinned = errors.New("cannot add to cache: all entries are pinned")
+
+	// ErrPinLimit is returned when pinning an entry would exceed a Cache's
+	// maximum number of pinned entries.
+	ErrPinLimit = errors.New("cannot pin entry: maximum pinned entries reached")
+)
+
+// PinnableCache is implemented by Caches whose entries may be pinned. Caches
+// created by NewLRU and NewTTL implement PinnableCache. Pinned entries are never
+// evicted to make room for other entries, though they may still be removed or
+// expire. An entry remains pinned when its value is replaced.
+//
+// When a full Cache contains only pinned entries, Add does not add the new entry
+// and returns false; TryAdd returns ErrAllPinned.
+type PinnableCache interface {
+	Cache
+
+	// TryAdd adds an item to the cache, like Add, returning ErrAllPinned if it
+	// could not be added.
+	TryAdd(key, value interface{}) (bool, error)
+
+	// AddPinned adds an item to the cache and pins it. Returns ErrPinLimit if
+	// the entry would exceed the maximum number of pinned entries, or
+	// ErrAllPinned if it could not be added.
+	AddPinned(key, value interface{}) error
+
+	// Pin pins the entry for key. Returns false if key is not present, or
+	// ErrPinLimit if the entry would exceed the maximum number of pinned
+	// entries.
+	Pin(key interface{}) (bool, error)
+
+	// Unpin unpins the entry for key. Returns true if the entry was pinned.
+	Unpin(key interface{}) bool
+}
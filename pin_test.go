@@ -0,0 +1,227 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+// testPinnableCache expects c to have size 3 and a maximum of 2 pinned entries.
+func testPinnableCache(t *testing.T, c PinnableCache) {
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	assert.Nil(t, c.AddPinned("config", 1))
+	c.Add("a", 2)
+	c.Add("b", 3)
+
+	pinned, err := c.Pin("missing")
+	assert.False(t, pinned)
+	assert.Nil(t, err)
+
+	c.Add("c", 4)
+	c.Add("d", 5)
+	assert.ArrayEqual(t, evicted, []interface{}{"a", "b"})
+	assert.ArrayEqual(t, keys(c), []interface{}{"config", "c", "d"})
+
+	// Pins survive updates.
+	assert.True(t, c.Add("config", 6))
+	c.Add("e", 7)
+	assert.ArrayEqual(t, keys(c), []interface{}{"d", "config", "e"})
+
+	pinned, err = c.Pin("d")
+	assert.True(t, pinned)
+	assert.Nil(t, err)
+	pinned, err = c.Pin("d")
+	assert.True(t, pinned)
+	assert.Nil(t, err)
+
+	pinned, err = c.Pin("e")
+	assert.True(t, pinned)
+	assert.Equal(t, err, ErrPinLimit)
+	assert.Equal(t, c.AddPinned("f", 8), ErrPinLimit)
+	_, ok := c.Get("f")
+	assert.False(t, ok)
+
+	c.Add("g", 9)
+	assert.ArrayEqual(t, keys(c), []interface{}{"d", "config", "g"})
+
+	// Removing a pinned entry frees a pin.
+	assert.True(t, c.Remove("d"))
+	assert.Nil(t, c.AddPinned("h", 10))
+
+	assert.False(t, c.Unpin("g"))
+	assert.True(t, c.Unpin("config"))
+	c.Add("i", 11)
+	assert.ArrayEqual(t, keys(c), []interface{}{"g", "h", "i"})
+}
+
+func testAllPinned(t *testing.T, c PinnableCache) {
+	c.Add("a", 1)
+	c.Add("b", 2)
+	_, err := c.Pin("a")
+	assert.Nil(t, err)
+	_, err = c.Pin("b")
+	assert.Nil(t, err)
+
+	existed, err := c.TryAdd("c", 3)
+	assert.False(t, existed)
+	assert.Equal(t, err, ErrAllPinned)
+
+	assert.False(t, c.Add("c", 3))
+	assert.ArrayEqual(t, keys(c), []interface{}{"a", "b"})
+
+	existed, err = c.TryAdd("a", 4)
+	assert.True(t, existed)
+	assert.Nil(t, err)
+
+	assert.Equal(t, c.AddPinned("c", 3), ErrPinLimit)
+	assert.Equal(t, c.(Resizable).Resize(1), ErrAllPinned)
+
+	assert.Nil(t, c.(Resizable).Resize(3))
+	assert.Nil(t, c.AddPinned("c", 3))
+	_, err = c.TryAdd("d", 4)
+	assert.Equal(t, err, ErrAllPinned)
+
+	c.Unpin("a")
+	assert.Nil(t, c.(Resizable).Resize(2))
+	assert.ArrayEqual(t, keys(c), []interface{}{"b", "c"})
+}
+
+func TestLRUCachePinned(t *testing.T) {
+	c, err := NewLRUWithOptions(3, LRUOptions{MaxPinned: -1})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "pinned")
+
+	c, _ = NewLRUWithOptions(3, LRUOptions{MaxPinned: 2})
+	testPinnableCache(t, c.(PinnableCache))
+
+	c, _ = NewLRU(2)
+	testAllPinned(t, c.(PinnableCache))
+}
+
+func TestTTLCachePinned(t *testing.T) {
+	c, err := NewTTLWithOptions(3, time.Minute, TTLOptions{MaxPinned: -1})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "pinned")
+
+	c, _ = NewTTLWithOptions(3, time.Minute, TTLOptions{MaxPinned: 2})
+	testPinnableCache(t, c.(PinnableCache))
+
+	c, _ = NewTTLWithOptions(2, time.Minute, TTLOptions{})
+	testAllPinned(t, c.(PinnableCache))
+}
+
+func TestTTLCachePinnedExpire(t *testing.T) {
+	c, _ := NewTTLWithOptions(2, time.Minute, TTLOptions{})
+	pc := c.(PinnableCache)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		assert.Nil(t, pc.AddPinned("a", 1))
+		assert.Nil(t, pc.AddPinned("b", 2))
+		ts.Advance(time.Minute)
+
+		existed, err := pc.TryAdd("c", 3)
+		assert.False(t, existed)
+		assert.Nil(t, err)
+		assert.Equal(t, c.(*ttlLruCache).retention.pinned, 1)
+
+		pinned, err := pc.Pin("b")
+		assert.False(t, pinned)
+		assert.Nil(t, err)
+		assert.Equal(t, c.(*ttlLruCache).retention.pinned, 0)
+	})
+}
+
+func TestTTLCacheResizePinned(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c, _ := NewTTLWithOptions(3, time.Minute, TTLOptions{})
+		c.(*ttlLruCache).timeSource = ts
+		pc := c.(PinnableCache)
+
+		// A failed resize leaves the cache unchanged, including its expired
+		// entries.
+		c.Add("expired", 1)
+		ts.Advance(time.Minute)
+		assert.Nil(t, pc.AddPinned("a", 2))
+		assert.Nil(t, pc.AddPinned("b", 3))
+		assert.Equal(t, c.(Resizable).Resize(1), ErrAllPinned)
+		assert.Equal(t, c.Len(), 3)
+
+		assert.Nil(t, c.(Resizable).Resize(2))
+		assert.ArrayEqual(t, keys(c), []interface{}{"a", "b"})
+
+		// Expired pinned entries do not count against the new size.
+		c, _ = NewTTLWithOptions(3, time.Minute, TTLOptions{})
+		c.(*ttlLruCache).timeSource = ts
+		pc = c.(PinnableCache)
+
+		assert.Nil(t, pc.AddPinned("expired", 1))
+		ts.Advance(time.Minute)
+		assert.Nil(t, pc.AddPinned("a", 2))
+		c.Add("b", 3)
+		assert.Nil(t, c.(Resizable).Resize(1))
+		assert.ArrayEqual(t, keys(c), []interface{}{"a"})
+	})
+}
+
+func testRestorePinned(t *testing.T, c Cache) {
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	src, _ := NewLRU(2)
+	src.Add("r1", 1)
+	src.Add("r2", 2)
+	buf := &bytes.Buffer{}
+	assert.Nil(t, Snapshot(src, buf, GobCodec))
+
+	assert.Nil(t, c.(PinnableCache).AddPinned("p", 0))
+	c.Add("q", 0)
+	assert.Nil(t, Restore(c, buf, GobCodec))
+	assert.ArrayEqual(t, keys(c), []interface{}{"p", "r2"})
+	assert.ArrayEqual(t, evicted, []interface{}{"q", "r1"})
+
+	// Entries that do not fit are skipped.
+	_, err := c.(PinnableCache).Pin("r2")
+	assert.Nil(t, err)
+	buf.Reset()
+	src.Add("r3", 3)
+	assert.Nil(t, Snapshot(src, buf, GobCodec))
+	assert.Nil(t, Restore(c, buf, GobCodec))
+	assert.HasSameElements(t, keys(c), []interface{}{"p", "r2"})
+}
+
+func TestLRUCacheRestorePinned(t *testing.T) {
+	c, _ := NewLRU(2)
+	testRestorePinned(t, c)
+}
+
+func TestTTLCacheRestorePinned(t *testing.T) {
+	c, _ := NewTTL(2, time.Minute)
+	testRestorePinned(t, c)
+}
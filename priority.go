@@ -0,0 +1,38 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+// DefaultPriority is the priority of entries added without one.
+const DefaultPriority = 0
+
+// PriorityCache is implemented by Caches whose entries have priorities. Caches
+// created by NewLRU and NewTTL implement PriorityCache. When an entry must be
+// evicted, it is chosen from the entries with the lowest priority, in the order
+// the Cache would otherwise evict them, so that an entry is never evicted while
+// one with a lower priority remains. Choosing an entry takes time linear in the
+// size of the Cache once any entry has a priority other than DefaultPriority.
+type PriorityCache interface {
+	Cache
+
+	// AddWithPriority adds an item to the cache with the given priority. Higher
+	// priorities are evicted later. Adding a key with Add resets its priority
+	// to DefaultPriority, but other writes, such as those made by AtomicCache
+	// methods, retain it. Returns true if the key already existed. Returns
+	// ErrAllPinned, without adding the item, if the Cache is full and every
+	// entry in it is pinned.
+	AddWithPriority(key, value interface{}, priority int) (bool, error)
+}
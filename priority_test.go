@@ -0,0 +1,100 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// testPriorityCache expects c to have size 3.
+func testPriorityCache(t *testing.T, c PriorityCache) {
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	existed, err := c.AddWithPriority("a", 1, 1)
+	assert.False(t, existed)
+	assert.Nil(t, err)
+	c.Add("b", 2)
+	c.AddWithPriority("c", 3, 1)
+
+	c.Add("d", 4)
+	c.Add("e", 5)
+	assert.ArrayEqual(t, evicted, []interface{}{"b", "d"})
+	assert.ArrayEqual(t, keys(c), []interface{}{"a", "c", "e"})
+
+	c.AddWithPriority("f", 6, 2)
+	assert.ArrayEqual(t, keys(c), []interface{}{"a", "c", "f"})
+
+	// Within a priority, the least recently used entry is evicted.
+	c.Get("a")
+	c.Add("g", 7)
+	assert.ArrayEqual(t, keys(c), []interface{}{"f", "a", "g"})
+
+	// Add resets the priority.
+	assert.True(t, c.Add("a", 8))
+	c.Add("h", 9)
+	c.Add("i", 10)
+	assert.ArrayEqual(t, keys(c), []interface{}{"f", "h", "i"})
+	v, _ := c.Get("f")
+	assert.Equal(t, v, 6)
+
+	c.AddWithPriority("j", 11, -1)
+	c.Add("k", 12)
+	assert.ArrayEqual(t, keys(c), []interface{}{"i", "f", "k"})
+	assert.ArrayEqual(t, evicted, []interface{}{"b", "d", "e", "c", "g", "a", "h", "j"})
+}
+
+func TestLRUCachePriority(t *testing.T) {
+	c, _ := NewLRU(3)
+	testPriorityCache(t, c.(PriorityCache))
+	assert.Equal(t, c.(*lruCache).retention.prioritized, 1)
+
+	c.Clear()
+	assert.Equal(t, c.(*lruCache).retention.prioritized, 0)
+}
+
+func TestTTLCachePriority(t *testing.T) {
+	c, _ := NewTTL(3, time.Minute)
+	testPriorityCache(t, c.(PriorityCache))
+	assert.Equal(t, c.(*ttlLruCache).retention.prioritized, 1)
+
+	c.Clear()
+	assert.Equal(t, c.(*ttlLruCache).retention.prioritized, 0)
+}
+
+func TestPriorityCacheKeepsPins(t *testing.T) {
+	c, _ := NewLRU(2)
+	pc := c.(PriorityCache)
+
+	pc.AddWithPriority("a", 1, -1)
+	c.Add("b", 2)
+	c.(PinnableCache).Pin("a")
+
+	c.Add("c", 3)
+	assert.ArrayEqual(t, keys(c), []interface{}{"a", "c"})
+
+	c.(PinnableCache).Pin("c")
+	existed, err := pc.AddWithPriority("d", 4, 1)
+	assert.False(t, existed)
+	assert.Equal(t, err, ErrAllPinned)
+	assert.ArrayEqual(t, keys(c), []interface{}{"a", "c"})
+}
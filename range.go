@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+// RangeOrder is the order in which Range visits entries.
+type RangeOrder int
+
+const (
+	// OldestFirst visits entries from least to most recently used.
+	OldestFirst RangeOrder = iota
+
+	// NewestFirst visits entries from most to least recently used.
+	NewestFirst
+
+	// ExpiringFirst visits entries in order of expiration, soonest first.
+	// Entries expiring at the same time are visited from least to most
+	// recently used. In Caches without expiration it is equivalent to
+	// OldestFirst.
+	ExpiringFirst
+)
+
+// RangeOptions configures Ranger.RangeWithOptions.
+type RangeOptions struct {
+	// Order is the order in which entries are visited.
+	Order RangeOrder
+
+	// Snapshot, if true, causes the entries to be copied before any are
+	// visited, so that the callback runs without holding the Cache's lock and
+	// may call methods on the Cache. Changes made after the copy is taken are
+	// not visible to the callback.
+	Snapshot bool
+}
+
+// Ranger is implemented by Caches that support iteration with early termination.
+// Caches created by NewLRU and NewTTL implement Ranger. Like ForEach, Range
+// does not modify eviction ordering and never visits expired entries.
+type Ranger interface {
+	// Range invokes f for each key/value in the cache from least to most
+	// recently used, stopping early if f returns false. The Cache's lock is
+	// held throughout, so f must not call methods on the Cache.
+	Range(f func(key, value interface{}) bool)
+
+	// RangeWithOptions invokes f for each key/value in the cache in the order
+	// given by opts, stopping early if f returns false. Unless opts.Snapshot is
+	// set, the Cache's lock is held throughout, so f must not call methods on
+	// the Cache.
+	RangeWithOptions(opts RangeOptions, f func(key, value interface{}) bool)
+}
+
+// rangeEntries invokes f for each entry until f returns false.
+func rangeEntries(entries []KeyValue, f func(key, value interface{}) bool) {
+	for _, e := range entries {
+		if !f(e.Key, e.Value) {
+			return
+		}
+	}
+}
+
+// reverseEntries reverses entries in place.
+func reverseEntries(entries []KeyValue) {
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ratelimit provides rate limiters keyed by string, with memory bounded
+// by a maximum number of tracked keys.
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/turbinelabs/cache"
+)
+
+// Limiter limits the rate of requests for each of a set of keys.
+type Limiter interface {
+	// Allow reports whether a single request for key may proceed now.
+	Allow(key string) bool
+
+	// AllowN reports whether n requests for key may proceed now. Either all n
+	// requests are allowed or none are. Returns false if n is not positive.
+	AllowN(key string, n int) bool
+
+	// Reserve reserves a single request for key and reports how long the
+	// caller must wait before proceeding. The reservation counts against the
+	// limit whether or not the caller proceeds.
+	Reserve(key string) Reservation
+}
+
+// Reservation describes when a reserved request may proceed.
+type Reservation struct {
+	ok    bool
+	delay time.Duration
+}
+
+// OK returns false if the request can never be satisfied by the Limiter.
+func (r Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long the caller must wait before proceeding. The result is
+// meaningless if OK returns false.
+func (r Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// table tracks per-key limiter state for at most size keys. Request counts for
+// each key are kept in a CountingCache. When a new key causes the CountingCache to
+// evict a key with the smallest count, that key's state is discarded as well.
+type table struct {
+	size   int
+	counts cache.CountingCache
+	states map[string]interface{}
+}
+
+func newTable(size int) (*table, error) {
+	counts, err := cache.NewCountingCache(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &table{
+		size:   size,
+		counts: counts,
+		states: make(map[string]interface{}, size+1),
+	}, nil
+}
+
+// get records a request for key and returns its state, creating it with
+// newState if the key is not tracked.
+func (t *table) get(key string, newState func() interface{}) interface{} {
+	t.counts.Inc(key)
+
+	if s, ok := t.states[key]; ok {
+		return s
+	}
+
+	s := newState()
+	t.states[key] = s
+
+	// A linear search finds the key evicted by the CountingCache to make room.
+	if len(t.states) > t.size {
+		for k := range t.states {
+			if t.counts.Get(k) == 0 {
+				delete(t.states, k)
+			}
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestTableForgetsEvictedKeys(t *testing.T) {
+	tbl, err := newTable(2)
+	assert.Nil(t, err)
+
+	newState := func() interface{} { return new(int) }
+
+	a := tbl.get("a", newState)
+	tbl.get("a", newState)
+	b := tbl.get("b", newState)
+	assert.True(t, tbl.get("a", newState) == a)
+	assert.True(t, tbl.get("b", newState) == b)
+	assert.Equal(t, len(tbl.states), 2)
+
+	// b has the fewest requests and is evicted
+	tbl.get("c", newState)
+	assert.Equal(t, len(tbl.states), 2)
+	_, ok := tbl.states["b"]
+	assert.False(t, ok)
+	assert.True(t, tbl.get("a", newState) == a)
+}
+
+func TestNewTableValidatesSize(t *testing.T) {
+	tbl, err := newTable(1)
+	assert.Nil(t, tbl)
+	assert.ErrorContains(t, err, "minimum counting cache size")
+}
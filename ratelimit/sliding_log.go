@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+)
+
+// NewSlidingLog creates a Limiter that allows at most limit requests per key in
+// any window of the given duration. The time of each allowed request is logged
+// until it leaves the window. At most size keys are tracked; when a new key would
+// exceed size, a key among those with the fewest requests is forgotten along with
+// its log. Size must be at least 2. If source is nil, the system clock is used.
+func NewSlidingLog(
+	size int,
+	limit int,
+	window time.Duration,
+	source tbntime.Source,
+) (Limiter, error) {
+	if limit < 1 {
+		return nil, errors.New("limit must be at least 1")
+	}
+
+	if window <= 0 {
+		return nil, errors.New("Must provide a positive window")
+	}
+
+	t, err := newTable(size)
+	if err != nil {
+		return nil, err
+	}
+
+	if source == nil {
+		source = tbntime.NewSource()
+	}
+
+	return &slidingLog{
+		limit:      limit,
+		window:     window,
+		table:      t,
+		timeSource: source,
+	}, nil
+}
+
+type slidingLog struct {
+	limit      int
+	window     time.Duration
+	table      *table
+	timeSource tbntime.Source
+	lock       sync.Mutex
+}
+
+// requestLog holds request times in ascending order. Reservations may add times
+// in the future.
+type requestLog struct {
+	times []time.Time
+}
+
+// log returns the log for key, with requests that have left the window ending now
+// removed.
+func (l *slidingLog) log(key string, now time.Time) *requestLog {
+	r := l.table.get(key, func() interface{} {
+		return &requestLog{times: make([]time.Time, 0, l.limit)}
+	}).(*requestLog)
+
+	start := now.Add(-l.window)
+	drop := 0
+	for drop < len(r.times) && !r.times[drop].After(start) {
+		drop++
+	}
+
+	if drop > 0 {
+		r.times = append(r.times[:0], r.times[drop:]...)
+	}
+
+	return r
+}
+
+func (l *slidingLog) Allow(key string) bool {
+	return l.AllowN(key, 1)
+}
+
+func (l *slidingLog) AllowN(key string, n int) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if n <= 0 || n > l.limit {
+		return false
+	}
+
+	now := l.timeSource.Now()
+	r := l.log(key, now)
+	if len(r.times)+n > l.limit {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		r.times = append(r.times, now)
+	}
+
+	return true
+}
+
+// Reserve logs a request at the earliest time it fits in the window, which is
+// when the limit-th most recent logged request leaves it.
+func (l *slidingLog) Reserve(key string) Reservation {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.timeSource.Now()
+	r := l.log(key, now)
+	if len(r.times) < l.limit {
+		r.times = append(r.times, now)
+		return Reservation{ok: true}
+	}
+
+	at := r.times[len(r.times)-l.limit].Add(l.window)
+	r.times = append(r.times, at)
+	return Reservation{ok: true, delay: at.Sub(now)}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewSlidingLog(t *testing.T) {
+	l, err := NewSlidingLog(10, 0, time.Second, nil)
+	assert.Nil(t, l)
+	assert.ErrorContains(t, err, "limit must be at least 1")
+
+	l, err = NewSlidingLog(10, 1, 0, nil)
+	assert.Nil(t, l)
+	assert.ErrorContains(t, err, "positive window")
+
+	l, err = NewSlidingLog(1, 1, time.Second, nil)
+	assert.Nil(t, l)
+	assert.ErrorContains(t, err, "minimum counting cache size")
+
+	l, err = NewSlidingLog(10, 5, time.Second, nil)
+	assert.Nil(t, err)
+	assert.NonNil(t, l)
+	impl := l.(*slidingLog)
+	assert.Equal(t, impl.limit, 5)
+	assert.Equal(t, impl.window, time.Second)
+	assert.NonNil(t, impl.table)
+	assert.NonNil(t, impl.timeSource)
+}
+
+func TestSlidingLogAllow(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		l, _ := NewSlidingLog(10, 3, time.Minute, ts)
+
+		assert.True(t, l.Allow("a"))
+		ts.Advance(10 * time.Second)
+		assert.True(t, l.Allow("a"))
+		assert.True(t, l.Allow("a"))
+		assert.False(t, l.Allow("a"))
+		assert.True(t, l.Allow("b"))
+
+		ts.Advance(49 * time.Second)
+		assert.False(t, l.Allow("a"))
+
+		ts.Advance(time.Second)
+		assert.True(t, l.Allow("a"))
+		assert.False(t, l.Allow("a"))
+	})
+}
+
+func TestSlidingLogAllowN(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		l, _ := NewSlidingLog(10, 3, time.Minute, ts)
+
+		assert.False(t, l.AllowN("a", 4))
+		assert.True(t, l.AllowN("a", 2))
+		assert.False(t, l.AllowN("a", 2))
+		assert.True(t, l.AllowN("a", 1))
+
+		// Non-positive counts neither succeed nor remove logged requests.
+		assert.False(t, l.AllowN("a", 0))
+		assert.False(t, l.AllowN("a", -5))
+		assert.False(t, l.Allow("a"))
+
+		ts.Advance(time.Minute)
+		assert.True(t, l.AllowN("a", 3))
+	})
+}
+
+func TestSlidingLogReserve(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		l, _ := NewSlidingLog(10, 2, time.Minute, ts)
+
+		r := l.Reserve("a")
+		assert.True(t, r.OK())
+		assert.Equal(t, r.Delay(), time.Duration(0))
+
+		ts.Advance(10 * time.Second)
+		r = l.Reserve("a")
+		assert.True(t, r.OK())
+		assert.Equal(t, r.Delay(), time.Duration(0))
+
+		r = l.Reserve("a")
+		assert.True(t, r.OK())
+		assert.Equal(t, r.Delay(), 50*time.Second)
+
+		r = l.Reserve("a")
+		assert.True(t, r.OK())
+		assert.Equal(t, r.Delay(), time.Minute)
+
+		assert.False(t, l.Allow("a"))
+	})
+}
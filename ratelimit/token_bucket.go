@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+)
+
+// NewTokenBucket creates a Limiter that gives each key a bucket holding up to
+// burst tokens, refilled at rate tokens per second. Each request consumes a
+// token. Buckets start full. At most size keys are tracked; when a new key would
+// exceed size, a key among those with the fewest requests is forgotten, and its
+// bucket starts full if it is seen again. Size must be at least 2. If source is
+// nil, the system clock is used.
+func NewTokenBucket(
+	size int,
+	rate float64,
+	burst int,
+	source tbntime.Source,
+) (Limiter, error) {
+	if rate < 0 {
+		return nil, errors.New("rate must not be negative")
+	}
+
+	if burst < 1 {
+		return nil, errors.New("burst must be at least 1")
+	}
+
+	t, err := newTable(size)
+	if err != nil {
+		return nil, err
+	}
+
+	if source == nil {
+		source = tbntime.NewSource()
+	}
+
+	return &tokenBucket{
+		rate:       rate,
+		burst:      burst,
+		table:      t,
+		timeSource: source,
+	}, nil
+}
+
+type tokenBucket struct {
+	rate       float64
+	burst      int
+	table      *table
+	timeSource tbntime.Source
+	lock       sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucket returns the refilled bucket for key.
+func (l *tokenBucket) bucket(key string, now time.Time) *bucket {
+	b := l.table.get(key, func() interface{} {
+		return &bucket{tokens: float64(l.burst), last: now}
+	}).(*bucket)
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(l.burst), b.tokens+elapsed.Seconds()*l.rate)
+		b.last = now
+	}
+
+	return b
+}
+
+func (l *tokenBucket) Allow(key string) bool {
+	return l.AllowN(key, 1)
+}
+
+func (l *tokenBucket) AllowN(key string, n int) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if n <= 0 || n > l.burst {
+		return false
+	}
+
+	b := l.bucket(key, l.timeSource.Now())
+	if b.tokens < float64(n) {
+		return false
+	}
+
+	b.tokens -= float64(n)
+	return true
+}
+
+// Reserve consumes a token from key's bucket, possibly leaving it in deficit, and
+// returns the time until the deficit is refilled.
+func (l *tokenBucket) Reserve(key string) Reservation {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b := l.bucket(key, l.timeSource.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return Reservation{ok: true}
+	}
+
+	if l.rate == 0 {
+		return Reservation{}
+	}
+
+	b.tokens--
+	wait := -b.tokens / l.rate
+	return Reservation{ok: true, delay: time.Duration(wait * float64(time.Second))}
+}
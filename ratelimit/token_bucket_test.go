@@ -0,0 +1,119 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewTokenBucket(t *testing.T) {
+	l, err := NewTokenBucket(10, -1, 1, nil)
+	assert.Nil(t, l)
+	assert.ErrorContains(t, err, "rate must not be negative")
+
+	l, err = NewTokenBucket(10, 1, 0, nil)
+	assert.Nil(t, l)
+	assert.ErrorContains(t, err, "burst must be at least 1")
+
+	l, err = NewTokenBucket(1, 1, 1, nil)
+	assert.Nil(t, l)
+	assert.ErrorContains(t, err, "minimum counting cache size")
+
+	l, err = NewTokenBucket(10, 2, 5, nil)
+	assert.Nil(t, err)
+	assert.NonNil(t, l)
+	impl := l.(*tokenBucket)
+	assert.Equal(t, impl.rate, 2.0)
+	assert.Equal(t, impl.burst, 5)
+	assert.NonNil(t, impl.table)
+	assert.NonNil(t, impl.timeSource)
+}
+
+func TestTokenBucketAllow(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		l, _ := NewTokenBucket(10, 2, 3, ts)
+
+		assert.True(t, l.Allow("a"))
+		assert.True(t, l.Allow("a"))
+		assert.True(t, l.Allow("a"))
+		assert.False(t, l.Allow("a"))
+		assert.True(t, l.Allow("b"))
+
+		ts.Advance(500 * time.Millisecond)
+		assert.True(t, l.Allow("a"))
+		assert.False(t, l.Allow("a"))
+
+		// refill is capped at burst
+		ts.Advance(time.Hour)
+		assert.True(t, l.AllowN("a", 3))
+		assert.False(t, l.Allow("a"))
+	})
+}
+
+func TestTokenBucketAllowN(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		l, _ := NewTokenBucket(10, 1, 3, ts)
+
+		assert.False(t, l.AllowN("a", 4))
+		assert.True(t, l.AllowN("a", 2))
+		assert.False(t, l.AllowN("a", 2))
+		assert.True(t, l.AllowN("a", 1))
+
+		// Non-positive counts neither succeed nor refill the bucket.
+		assert.False(t, l.AllowN("a", 0))
+		assert.False(t, l.AllowN("a", -5))
+		assert.False(t, l.Allow("a"))
+	})
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		l, _ := NewTokenBucket(10, 2, 1, ts)
+
+		r := l.Reserve("a")
+		assert.True(t, r.OK())
+		assert.Equal(t, r.Delay(), time.Duration(0))
+
+		r = l.Reserve("a")
+		assert.True(t, r.OK())
+		assert.Equal(t, r.Delay(), 500*time.Millisecond)
+
+		r = l.Reserve("a")
+		assert.True(t, r.OK())
+		assert.Equal(t, r.Delay(), time.Second)
+
+		assert.False(t, l.Allow("a"))
+
+		ts.Advance(time.Second)
+		assert.False(t, l.Allow("a"))
+		ts.Advance(500 * time.Millisecond)
+		assert.True(t, l.Allow("a"))
+	})
+}
+
+func TestTokenBucketReserveWithoutRefill(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		l, _ := NewTokenBucket(10, 0, 1, ts)
+
+		assert.True(t, l.Reserve("a").OK())
+		assert.False(t, l.Reserve("a").OK())
+	})
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+// BulkRemover is implemented by Caches that can remove many entries at once.
+// Caches created by NewLRU and NewTTL implement BulkRemover. Each method holds the
+// Cache's lock for its duration, so the removal is atomic with respect to other
+// operations on the Cache. Both consider only the entries that ForEach would
+// visit. Removed entries are not reported to eviction hooks.
+type BulkRemover interface {
+	// RemoveIf removes each entry for which pred returns true and returns the
+	// number of entries removed. Pred must not call methods on the Cache.
+	RemoveIf(pred func(key, value interface{}) bool) int
+
+	// RemovePrefix removes each entry with a string key beginning with prefix
+	// and returns the number of entries removed. The first call indexes the
+	// Cache's keys, taking time linear in its size; the index is then kept up
+	// to date by subsequent operations.
+	RemovePrefix(prefix string) int
+}
+
+// CountingBulkRemover is implemented by CountingCaches that can remove many keys
+// at once. CountingCaches created by NewCountingCache implement
+// CountingBulkRemover. Each method holds the cache's lock for its duration.
+type CountingBulkRemover interface {
+	// RemoveIf removes each key for which pred returns true and returns the
+	// number of keys removed. Pred must not call methods on the cache.
+	RemoveIf(pred func(key string, count int) bool) int
+
+	// RemovePrefix removes each key beginning with prefix and returns the
+	// number of keys removed. As with BulkRemover, the first call indexes the
+	// cache's keys.
+	RemovePrefix(prefix string) int
+}
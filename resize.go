@@ -0,0 +1,45 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// Resizable is implemented by caches whose capacity may be changed while in use.
+// Caches created by NewLRU and NewTTL and CountingCaches created by
+// NewCountingCache implement Resizable.
+type Resizable interface {
+	// Resize changes the maximum number of entries in the cache. If the cache
+	// holds more entries than the new size, entries are evicted as if to make
+	// room for new entries, and reported to eviction hooks, if any. Returns an
+	// error, leaving the cache unchanged, if size is invalid for the cache.
+	Resize(size int) error
+}
+
+// resizeLRU copies the entries of lru, which must fit, into a new LRU with the
+// given positive size, preserving their order.
+func resizeLRU(lru *simplelru.LRU, size int, onEvict simplelru.EvictCallback) *simplelru.LRU {
+	resized, _ := simplelru.NewLRU(size, onEvict)
+
+	for _, key := range lru.Keys() {
+		value, _ := lru.Peek(key)
+		resized.Add(key, value)
+	}
+
+	return resized
+}
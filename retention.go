@@ -0,0 +1,117 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// retention is the pin and priority of a cache entry. Entries embed it so that a
+// cache's retentionCounts can update it and choose entries to evict.
+type retention struct {
+	pinned   bool
+	priority int
+}
+
+func (r *retention) retained() *retention {
+	return r
+}
+
+// retainer is implemented by the entries that embed a retention.
+type retainer interface {
+	retained() *retention
+}
+
+// retentionCounts tracks the pinned and prioritized entries of an LRU or TTL
+// cache, which must report each entry's removal to forget.
+type retentionCounts struct {
+	pinned      int
+	maxPinned   int
+	prioritized int
+}
+
+// forget accounts for the removal of an entry.
+func (rc *retentionCounts) forget(r *retention) {
+	if r.pinned {
+		rc.pinned--
+	}
+	if r.priority != DefaultPriority {
+		rc.prioritized--
+	}
+}
+
+func (rc *retentionCounts) setPriority(r *retention, priority int) {
+	if r.priority != DefaultPriority {
+		rc.prioritized--
+	}
+	if priority != DefaultPriority {
+		rc.prioritized++
+	}
+	r.priority = priority
+}
+
+// victim returns the key of the least recently used of the unpinned entries in l
+// with the lowest priority, or false if every entry is pinned. The entries are
+// scanned only if any is pinned or has a priority.
+func (rc *retentionCounts) victim(l *simplelru.LRU) (interface{}, bool) {
+	if rc.pinned == 0 && rc.prioritized == 0 {
+		key, _, ok := l.GetOldest()
+		return key, ok
+	}
+
+	var (
+		victim interface{}
+		lowest *retention
+	)
+	for _, key := range l.Keys() {
+		v, _ := l.Peek(key)
+		if r := v.(retainer).retained(); !r.pinned && (lowest == nil || r.priority < lowest.priority) {
+			victim, lowest = key, r
+		}
+	}
+
+	return victim, lowest != nil
+}
+
+// canPin reports whether an entry may be pinned in a cache of the given size, which
+// is always the case if it is pinned already.
+func (rc *retentionCounts) canPin(pinned bool, size int) bool {
+	limit := size
+	if rc.maxPinned > 0 && rc.maxPinned < size {
+		limit = rc.maxPinned
+	}
+
+	return pinned || rc.pinned < limit
+}
+
+func (rc *retentionCounts) pin(r *retention) {
+	if !r.pinned {
+		r.pinned = true
+		rc.pinned++
+	}
+}
+
+// unpin unpins an entry, returning true if it was pinned.
+func (rc *retentionCounts) unpin(r *retention) bool {
+	if !r.pinned {
+		return false
+	}
+
+	r.pinned = false
+	rc.pinned--
+	return true
+}
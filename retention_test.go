@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestRetentionCounts(t *testing.T) {
+	rc := retentionCounts{maxPinned: 1}
+	l, _ := simplelru.NewLRU(3, func(_, v interface{}) { rc.forget(v.(retainer).retained()) })
+
+	entries := []*lruEntry{{value: "a"}, {value: "b"}, {value: "c"}}
+	for _, e := range entries {
+		l.Add(e.value, e)
+	}
+
+	key, ok := rc.victim(l)
+	assert.True(t, ok)
+	assert.Equal(t, key, "a")
+
+	assert.True(t, rc.canPin(false, 3))
+	rc.pin(&entries[0].retention)
+	assert.False(t, rc.canPin(false, 3))
+	assert.True(t, rc.canPin(true, 3))
+	rc.setPriority(&entries[1].retention, 1)
+
+	key, ok = rc.victim(l)
+	assert.True(t, ok)
+	assert.Equal(t, key, "c")
+
+	l.Remove("b")
+	assert.Equal(t, rc.prioritized, 0)
+	assert.True(t, rc.unpin(&entries[0].retention))
+	assert.False(t, rc.unpin(&entries[0].retention))
+	assert.Equal(t, rc.pinned, 0)
+
+	rc.pin(&entries[0].retention)
+	rc.pin(&entries[2].retention)
+	_, ok = rc.victim(l)
+	assert.False(t, ok)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const snapshotVersion = 1
+
+type snapshotHeader struct {
+	Version int
+	Len     int
+}
+
+type snapshotEntry struct {
+	Key      interface{}
+	Value    interface{}
+	Deadline time.Time
+
+	// Stale is when the entry's TTL passes, if it is served stale until
+	// Deadline. It is zero otherwise.
+	Stale time.Time
+}
+
+// snapshotter is implemented by Caches that preserve recency and expiration
+// across Snapshot and Restore.
+type snapshotter interface {
+	// snapshot returns the cache's live entries from least to most recently
+	// used.
+	snapshot() []snapshotEntry
+
+	// restore adds entries, ordered from least to most recently used, skipping
+	// those whose deadlines have passed. Entries are evicted to make room as
+	// they are by Add, and entries that do not fit are skipped.
+	restore(entries []snapshotEntry)
+}
+
+// Snapshot writes the contents of c to w using codec. Caches created by NewLRU
+// and NewTTL record their recency order, and NewTTL caches record the deadline
+// of each entry. For other Caches, the entries are written in ForEach order.
+func Snapshot(c Cache, w io.Writer, codec Codec) error {
+	var entries []snapshotEntry
+	if s, ok := c.(snapshotter); ok {
+		entries = s.snapshot()
+	} else {
+		c.ForEach(func(key, value interface{}) {
+			entries = append(entries, snapshotEntry{Key: key, Value: value})
+		})
+	}
+
+	enc := codec.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{Version: snapshotVersion, Len: len(entries)}); err != nil {
+		return err
+	}
+
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Restore reads a snapshot written by Snapshot from r using codec and adds its
+// entries to c. Recency order is restored, and for caches created by NewTTL,
+// entries keep their original deadlines and entries that have since expired are
+// skipped. Entries from snapshots without deadlines, such as those of caches
+// created by NewLRU, are given the full TTL of a NewTTL cache. If the snapshot
+// cannot be read, c is not modified.
+func Restore(c Cache, r io.Reader, codec Codec) error {
+	dec := codec.NewDecoder(r)
+
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	if header.Len < 0 {
+		return fmt.Errorf("invalid snapshot length %d", header.Len)
+	}
+
+	// The header is not trusted to size the entries, which are read until Len
+	// have been decoded or the input ends.
+	var entries []snapshotEntry
+	for i := 0; i < header.Len; i++ {
+		var e snapshotEntry
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+
+	if s, ok := c.(snapshotter); ok {
+		s.restore(entries)
+		return nil
+	}
+
+	for _, e := range entries {
+		c.Add(e.Key, e.Value)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+func keys(c Cache) []interface{} {
+	result := []interface{}{}
+	c.ForEach(func(k, _ interface{}) {
+		result = append(result, k)
+	})
+	return result
+}
+
+func TestSnapshotRestoreLRU(t *testing.T) {
+	for _, codec := range []Codec{GobCodec, JSONCodec} {
+		c, _ := NewLRU(5)
+		c.Add("k1", "v1")
+		c.Add("k2", "v2")
+		c.Add("k3", "v3")
+		c.Get("k1")
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, Snapshot(c, buf, codec))
+
+		restored, _ := NewLRU(5)
+		assert.Nil(t, Restore(restored, buf, codec))
+		assert.ArrayEqual(t, keys(restored), []interface{}{"k2", "k3", "k1"})
+
+		v, ok := restored.Get("k2")
+		assert.True(t, ok)
+		assert.Equal(t, v, "v2")
+	}
+}
+
+func TestSnapshotRestoreTTL(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c, _ := NewTTL(5, 10*time.Second)
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("k1", 1)
+		ts.Advance(5 * time.Second)
+		c.Add("k2", 2)
+		c.Add("k3", 3)
+		c.Get("k2")
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, Snapshot(c, buf, GobCodec))
+
+		// k1 expires while the snapshot is on disk
+		ts.Advance(6 * time.Second)
+
+		restored, _ := NewTTL(5, 10*time.Second)
+		restored.(*ttlLruCache).timeSource = ts
+		assert.Nil(t, Restore(restored, buf, GobCodec))
+		assert.ArrayEqual(t, keys(restored), []interface{}{"k3", "k2"})
+
+		v, ok := restored.Get("k2")
+		assert.True(t, ok)
+		assert.Equal(t, v, 2)
+
+		// deadlines are preserved, not reset
+		ts.Advance(4 * time.Second)
+		_, ok = restored.Get("k2")
+		assert.False(t, ok)
+	})
+}
+
+func TestRestoreLimitsDeadlinesToTTL(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c, _ := NewTTL(5, time.Minute)
+		c.(*ttlLruCache).timeSource = ts
+		c.Add("k1", 1)
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, Snapshot(c, buf, JSONCodec))
+
+		restored, _ := NewTTL(5, 10*time.Second)
+		restored.(*ttlLruCache).timeSource = ts
+		assert.Nil(t, Restore(restored, buf, JSONCodec))
+		assert.Equal(t, restored.Len(), 1)
+
+		ts.Advance(10 * time.Second)
+		_, ok := restored.Get("k1")
+		assert.False(t, ok)
+	})
+}
+
+func TestSnapshotRestoreOtherCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	src := NewMockCache(ctrl)
+	src.EXPECT().ForEach(gomock.Any()).Do(func(f func(k, v interface{})) {
+		f("k1", "v1")
+		f("k2", "v2")
+	})
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, Snapshot(src, buf, GobCodec))
+
+	dst := NewMockCache(ctrl)
+	gomock.InOrder(
+		dst.EXPECT().Add("k1", "v1").Return(false),
+		dst.EXPECT().Add("k2", "v2").Return(false),
+	)
+	assert.Nil(t, Restore(dst, buf, GobCodec))
+}
+
+func TestRestoreErrors(t *testing.T) {
+	c, _ := NewLRU(5)
+
+	assert.NonNil(t, Restore(c, bytes.NewBufferString("{"), JSONCodec))
+
+	buf := bytes.NewBufferString(`{"Version": 2, "Len": 0}`)
+	assert.ErrorContains(t, Restore(c, buf, JSONCodec), "unsupported snapshot version 2")
+
+	buf = bytes.NewBufferString(`{"Version": 1, "Len": 2} {"Key": "k1", "Value": "v1"}`)
+	assert.NonNil(t, Restore(c, buf, JSONCodec))
+	assert.Equal(t, c.Len(), 0)
+
+	buf = bytes.NewBufferString(`{"Version": 1, "Len": -1}`)
+	assert.ErrorContains(t, Restore(c, buf, JSONCodec), "invalid snapshot length -1")
+
+	buf = bytes.NewBufferString(`{"Version": 1, "Len": 1000000000000} {"Key": "k1", "Value": "v1"}`)
+	assert.NonNil(t, Restore(c, buf, JSONCodec))
+	assert.Equal(t, c.Len(), 0)
+}
+
+func TestRestoreLRUSnapshotIntoTTL(t *testing.T) {
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c, _ := NewLRU(5)
+		c.Add("k1", 1)
+		c.Add("k2", 2)
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, Snapshot(c, buf, GobCodec))
+
+		restored, _ := NewTTL(5, time.Minute)
+		restored.(*ttlLruCache).timeSource = ts
+		assert.Nil(t, Restore(restored, buf, GobCodec))
+		assert.ArrayEqual(t, keys(restored), []interface{}{"k1", "k2"})
+
+		ts.Advance(time.Minute - time.Nanosecond)
+		v, ok := restored.Get("k1")
+		assert.True(t, ok)
+		assert.Equal(t, v, 1)
+
+		ts.Advance(time.Nanosecond)
+		_, ok = restored.Get("k2")
+		assert.False(t, ok)
+	})
+}
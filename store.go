@@ -0,0 +1,534 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is the interval between write-behind flushes if no other
+// interval is configured.
+const DefaultFlushInterval = time.Second
+
+// Store is a backing store, such as a database, for a Cache.
+type Store interface {
+	// Load retrieves the value for key. The second return value is false if
+	// the key is not present.
+	Load(key interface{}) (interface{}, bool, error)
+
+	// Store persists the value for key.
+	Store(key, value interface{}) error
+
+	// Delete removes key. Deleting a key that is not present is not an error.
+	Delete(key interface{}) error
+}
+
+// BatchStore is a Store that can operate on several keys at once. GetMulti uses
+// LoadBatch, and write-behind flushes use StoreBatch and DeleteBatch, when they
+// are available.
+type BatchStore interface {
+	Store
+
+	// LoadBatch retrieves the values for keys. Keys that are not present are
+	// omitted from the result.
+	LoadBatch(keys []interface{}) (map[interface{}]interface{}, error)
+
+	// StoreBatch persists each of the given key-value pairs.
+	StoreBatch(entries map[interface{}]interface{}) error
+
+	// DeleteBatch removes each of the given keys.
+	DeleteBatch(keys []interface{}) error
+}
+
+// StoreOptions configures a StoreCache created by NewStoreCache.
+type StoreOptions struct {
+	// WriteBehind causes additions and removals to be queued and persisted
+	// asynchronously. Otherwise, they are persisted before Add or Remove
+	// returns.
+	WriteBehind bool
+
+	// FlushInterval is the interval between write-behind flushes. If zero,
+	// DefaultFlushInterval is used.
+	FlushInterval time.Duration
+
+	// OnError, if non-nil, is invoked with errors returned by the Store,
+	// including those from background flushes.
+	OnError func(error)
+}
+
+// StoreCache is a Cache kept in sync with a Store.
+type StoreCache interface {
+	MultiCache
+
+	// Flush persists queued writes. It returns the first error encountered;
+	// writes that fail remain queued. Flush is a no-op without write-behind.
+	Flush() error
+
+	// Close stops background flushes and flushes any queued writes.
+	Close() error
+}
+
+// NewStoreCache wraps c so that it is kept in sync with s. Get loads keys missing
+// from c from s. Add and Remove write to s: immediately, if write-through, or
+// from a queue flushed every FlushInterval and on Close, if write-behind. Queued
+// writes to the same key are coalesced so only the latest is persisted, and Get
+// observes queued writes before they are persisted. Operations on the same key are
+// serialized, so that a value loaded by Get cannot overwrite a concurrent Add or
+// Remove, and write-through Adds and Removes leave c and s in agreement. GetMulti
+// loads the keys missing from c with a single LoadBatch call if s is a
+// BatchStore, and caches the loaded values only if no Add or Remove overlapped
+// the load.
+//
+// With write-through, Add and Remove do not modify c if the Store returns an
+// error. Clear removes entries from c but not from s.
+func NewStoreCache(c Cache, s Store, opts StoreOptions) (StoreCache, error) {
+	if c == nil || s == nil {
+		return nil, errors.New("Must provide a Cache and a Store")
+	}
+
+	if opts.FlushInterval < 0 {
+		return nil, errors.New("Must provide a non-negative flush interval")
+	}
+
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+
+	sc := &storeCache{
+		cache:   c,
+		store:   s,
+		opts:    opts,
+		pending: map[interface{}]pendingWrite{},
+	}
+
+	if opts.WriteBehind {
+		sc.stop = make(chan struct{})
+		sc.done = make(chan struct{})
+		go sc.flushLoop()
+	}
+
+	return sc, nil
+}
+
+type storeCache struct {
+	cache     Cache
+	store     Store
+	opts      StoreOptions
+	pending   map[interface{}]pendingWrite
+	inflight  map[interface{}]pendingWrite
+	keys      keyLocks
+	writes    uint64
+	writing   int
+	lock      sync.Mutex
+	flushLock sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type pendingWrite struct {
+	value   interface{}
+	deleted bool
+}
+
+// keyLocks provides a mutex for each key, which exists only while in use.
+type keyLocks struct {
+	lock  sync.Mutex
+	locks map[interface{}]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// acquire locks key and returns a function that unlocks it.
+func (l *keyLocks) acquire(key interface{}) func() {
+	l.lock.Lock()
+	if l.locks == nil {
+		l.locks = map[interface{}]*keyLock{}
+	}
+
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.lock.Unlock()
+
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+
+		l.lock.Lock()
+		kl.refs--
+		if kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.lock.Unlock()
+	}
+}
+
+func (c *storeCache) reportError(err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
+
+func (c *storeCache) Get(key interface{}) (interface{}, bool) {
+	if value, ok := c.cache.Get(key); ok {
+		return value, true
+	}
+
+	unlock := c.keys.acquire(key)
+	defer unlock()
+
+	// Another Get may have loaded the key while this one waited.
+	if value, ok := c.cache.Get(key); ok {
+		return value, true
+	}
+
+	if value, ok, queued := c.getQueued(key); queued {
+		return value, ok
+	}
+
+	value, ok, err := c.store.Load(key)
+	if err != nil {
+		c.reportError(err)
+		return nil, false
+	}
+
+	if ok {
+		c.cache.Add(key, value)
+	}
+
+	return value, ok
+}
+
+func (c *storeCache) GetMulti(keys []interface{}) ([]interface{}, []bool) {
+	batch, ok := c.store.(BatchStore)
+	if !ok {
+		values := make([]interface{}, len(keys))
+		found := make([]bool, len(keys))
+		for i, key := range keys {
+			values[i], found[i] = c.Get(key)
+		}
+		return values, found
+	}
+
+	values, found := GetMulti(c.cache, keys)
+
+	var missing []interface{}
+	for i, key := range keys {
+		if found[i] {
+			continue
+		}
+
+		if value, ok, queued := c.getQueued(key); queued {
+			values[i], found[i] = value, ok
+			continue
+		}
+
+		missing = append(missing, key)
+	}
+
+	if len(missing) == 0 {
+		return values, found
+	}
+
+	c.lock.Lock()
+	writes := c.writes
+	c.lock.Unlock()
+
+	loaded, err := batch.LoadBatch(missing)
+	if err != nil {
+		c.reportError(err)
+		return values, found
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// A write that overlapped the load may have been made after its key was
+	// loaded, so the loaded values are returned but not cached.
+	cache := c.writes == writes && c.writing == 0
+	for i, key := range keys {
+		if found[i] {
+			continue
+		}
+
+		if value, ok := loaded[key]; ok {
+			values[i], found[i] = value, true
+			if cache {
+				c.cache.Add(key, value)
+			}
+		}
+	}
+
+	return values, found
+}
+
+func (c *storeCache) AddMulti(entries []KeyValue) []bool {
+	added := make([]bool, len(entries))
+	for i, e := range entries {
+		added[i] = c.Add(e.Key, e.Value)
+	}
+	return added
+}
+
+func (c *storeCache) RemoveMulti(keys []interface{}) []bool {
+	removed := make([]bool, len(keys))
+	for i, key := range keys {
+		removed[i] = c.Remove(key)
+	}
+	return removed
+}
+
+// getQueued returns the value of a queued or in-flight write for key, adding it to
+// the cache. The third return value is false if no write is queued or in flight.
+func (c *storeCache) getQueued(key interface{}) (interface{}, bool, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p, queued := c.pending[key]
+	if !queued {
+		p, queued = c.inflight[key]
+	}
+
+	if !queued || p.deleted {
+		return nil, false, queued
+	}
+
+	c.cache.Add(key, p.value)
+	return p.value, true, true
+}
+
+func (c *storeCache) Add(key, value interface{}) bool {
+	unlock := c.keys.acquire(key)
+	defer unlock()
+
+	if !c.opts.WriteBehind {
+		c.beginWrite()
+		defer c.endWrite()
+
+		if err := c.store.Store(key, value); err != nil {
+			c.reportError(err)
+			return false
+		}
+
+		return c.cache.Add(key, value)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writes++
+	c.pending[key] = pendingWrite{value: value}
+	return c.cache.Add(key, value)
+}
+
+func (c *storeCache) Remove(key interface{}) bool {
+	unlock := c.keys.acquire(key)
+	defer unlock()
+
+	if !c.opts.WriteBehind {
+		c.beginWrite()
+		defer c.endWrite()
+
+		if err := c.store.Delete(key); err != nil {
+			c.reportError(err)
+			return false
+		}
+
+		return c.cache.Remove(key)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writes++
+	c.pending[key] = pendingWrite{deleted: true}
+	return c.cache.Remove(key)
+}
+
+// beginWrite and endWrite bracket a write-through Add or Remove, so that GetMulti
+// can tell whether one overlapped its batch load.
+func (c *storeCache) beginWrite() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writing++
+	c.writes++
+}
+
+func (c *storeCache) endWrite() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writing--
+	c.writes++
+}
+
+func (c *storeCache) ForEach(f func(key, value interface{})) {
+	c.cache.ForEach(f)
+}
+
+func (c *storeCache) Clear() {
+	c.cache.Clear()
+}
+
+func (c *storeCache) Len() int {
+	return c.cache.Len()
+}
+
+func (c *storeCache) flushLoop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// requeue ends a flush, restoring writes that failed to persist unless they have
+// since been superseded.
+func (c *storeCache) requeue(failed map[interface{}]pendingWrite) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for key, p := range failed {
+		if _, ok := c.pending[key]; !ok {
+			c.pending[key] = p
+		}
+	}
+
+	c.inflight = nil
+}
+
+func (c *storeCache) Flush() error {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+
+	// Writes remain visible to Get until they are persisted or requeued.
+	c.lock.Lock()
+	pending := c.pending
+	c.pending = map[interface{}]pendingWrite{}
+	c.inflight = pending
+	c.lock.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var err error
+	if batch, ok := c.store.(BatchStore); ok {
+		err = c.flushBatch(batch, pending)
+	} else {
+		err = c.flushEach(pending)
+	}
+
+	if err != nil {
+		c.reportError(err)
+	}
+
+	return err
+}
+
+func (c *storeCache) flushBatch(batch BatchStore, pending map[interface{}]pendingWrite) error {
+	stores := map[interface{}]interface{}{}
+	deletes := []interface{}{}
+	for key, p := range pending {
+		if p.deleted {
+			deletes = append(deletes, key)
+		} else {
+			stores[key] = p.value
+		}
+	}
+
+	failed := map[interface{}]pendingWrite{}
+
+	var firstErr error
+	if len(stores) > 0 {
+		if err := batch.StoreBatch(stores); err != nil {
+			firstErr = err
+			for key, value := range stores {
+				failed[key] = pendingWrite{value: value}
+			}
+		}
+	}
+
+	if len(deletes) > 0 {
+		if err := batch.DeleteBatch(deletes); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			for _, key := range deletes {
+				failed[key] = pendingWrite{deleted: true}
+			}
+		}
+	}
+
+	c.requeue(failed)
+	return firstErr
+}
+
+func (c *storeCache) flushEach(pending map[interface{}]pendingWrite) error {
+	failed := map[interface{}]pendingWrite{}
+
+	var firstErr error
+	for key, p := range pending {
+		var err error
+		if p.deleted {
+			err = c.store.Delete(key)
+		} else {
+			err = c.store.Store(key, p.value)
+		}
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed[key] = p
+		}
+	}
+
+	c.requeue(failed)
+	return firstErr
+}
+
+func (c *storeCache) Close() error {
+	if !c.opts.WriteBehind {
+		return nil
+	}
+
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+
+	return c.Flush()
+}
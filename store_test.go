@@ -0,0 +1,447 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+type testStore struct {
+	data    map[interface{}]interface{}
+	writes  int
+	batches int
+	err     error
+	lock    sync.Mutex
+}
+
+func newTestStore() *testStore {
+	return &testStore{data: map[interface{}]interface{}{}}
+}
+
+func (s *testStore) Load(key interface{}) (interface{}, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return nil, false, s.err
+	}
+	v, ok := s.data[key]
+	return v, ok, nil
+}
+
+func (s *testStore) Store(key, value interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.writes++
+	s.data[key] = value
+	return nil
+}
+
+func (s *testStore) Delete(key interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.writes++
+	delete(s.data, key)
+	return nil
+}
+
+func (s *testStore) get(key interface{}) (interface{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	v, ok := s.data[key]
+	return v, ok
+}
+
+// blockingStore blocks the operation named by op until release is closed,
+// signalling entered once it has been called.
+type blockingStore struct {
+	*testStore
+	op      string
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingStore(op string) blockingStore {
+	return blockingStore{newTestStore(), op, make(chan struct{}), make(chan struct{})}
+}
+
+func (s blockingStore) block(op string) {
+	if op == s.op {
+		close(s.entered)
+		<-s.release
+	}
+}
+
+func (s blockingStore) Load(key interface{}) (interface{}, bool, error) {
+	s.block("load")
+	return s.testStore.Load(key)
+}
+
+func (s blockingStore) Delete(key interface{}) error {
+	s.block("delete")
+	return s.testStore.Delete(key)
+}
+
+type testBatchStore struct {
+	*testStore
+}
+
+func (s testBatchStore) LoadBatch(keys []interface{}) (map[interface{}]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.batches++
+	values := map[interface{}]interface{}{}
+	for _, k := range keys {
+		if v, ok := s.data[k]; ok {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+func (s testBatchStore) StoreBatch(entries map[interface{}]interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.batches++
+	for k, v := range entries {
+		s.data[k] = v
+	}
+	return nil
+}
+
+func (s testBatchStore) DeleteBatch(keys []interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.batches++
+	for _, k := range keys {
+		delete(s.data, k)
+	}
+	return nil
+}
+
+// blockingBatchStore blocks LoadBatch after it has read the store until release
+// is closed, signalling entered once it has been called.
+type blockingBatchStore struct {
+	testBatchStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s blockingBatchStore) LoadBatch(keys []interface{}) (map[interface{}]interface{}, error) {
+	values, err := s.testBatchStore.LoadBatch(keys)
+	close(s.entered)
+	<-s.release
+	return values, err
+}
+
+func TestNewStoreCache(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newTestStore()
+
+	sc, err := NewStoreCache(nil, s, StoreOptions{})
+	assert.Nil(t, sc)
+	assert.ErrorContains(t, err, "Cache and a Store")
+
+	sc, err = NewStoreCache(c, s, StoreOptions{FlushInterval: -1})
+	assert.Nil(t, sc)
+	assert.ErrorContains(t, err, "non-negative flush interval")
+
+	sc, err = NewStoreCache(c, s, StoreOptions{})
+	assert.Nil(t, err)
+	assert.NonNil(t, sc)
+	impl := sc.(*storeCache)
+	assert.Equal(t, impl.opts.FlushInterval, DefaultFlushInterval)
+	assert.Nil(t, impl.stop)
+	assert.Nil(t, sc.Close())
+}
+
+func TestStoreCacheWriteThrough(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newTestStore()
+	s.data["loaded"] = "from-store"
+
+	errs := []error{}
+	sc, _ := NewStoreCache(c, s, StoreOptions{OnError: func(err error) { errs = append(errs, err) }})
+
+	assert.False(t, sc.Add("k1", "v1"))
+	assert.True(t, sc.Add("k1", "v1-again"))
+	v, ok := s.get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v1-again")
+
+	v, ok = sc.Get("loaded")
+	assert.True(t, ok)
+	assert.Equal(t, v, "from-store")
+	v, ok = c.Get("loaded")
+	assert.True(t, ok)
+	assert.Equal(t, v, "from-store")
+	assert.Equal(t, sc.Len(), 2)
+
+	assert.True(t, sc.Remove("k1"))
+	_, ok = s.get("k1")
+	assert.False(t, ok)
+
+	_, ok = sc.Get("k1")
+	assert.False(t, ok)
+
+	s.err = errors.New("boom")
+	assert.False(t, sc.Add("k2", "v2"))
+	assert.False(t, sc.Remove("loaded"))
+	_, ok = c.Get("k2")
+	assert.False(t, ok)
+	_, ok = sc.Get("k3")
+	assert.False(t, ok)
+	assert.Equal(t, len(errs), 3)
+
+	sc.Clear()
+	assert.Equal(t, sc.Len(), 0)
+	assert.Equal(t, len(s.data), 1)
+}
+
+func TestStoreCacheWriteBehind(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newTestStore()
+	sc, _ := NewStoreCache(c, s, StoreOptions{WriteBehind: true, FlushInterval: time.Hour})
+	defer sc.Close()
+
+	sc.Add("k1", "v1")
+	sc.Add("k1", "v2")
+	sc.Add("k1", "v3")
+	sc.Add("k2", "v1")
+	sc.Remove("k2")
+	assert.Equal(t, s.writes, 0)
+
+	// queued writes are visible even if evicted from the cache
+	c.Clear()
+	v, ok := sc.Get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v3")
+	_, ok = sc.Get("k2")
+	assert.False(t, ok)
+
+	assert.Nil(t, sc.Flush())
+	assert.Equal(t, s.writes, 2)
+	v, ok = s.get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v3")
+
+	assert.Nil(t, sc.Flush())
+	assert.Equal(t, s.writes, 2)
+}
+
+func TestStoreCacheWriteBehindRetriesFailures(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newTestStore()
+
+	errs := []error{}
+	sc, _ := NewStoreCache(c, testBatchStore{s}, StoreOptions{
+		WriteBehind:   true,
+		FlushInterval: time.Hour,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+
+	sc.Add("k1", "v1")
+	sc.Add("k2", "v2")
+	sc.Remove("k3")
+
+	s.err = errors.New("boom")
+	assert.ErrorContains(t, sc.Flush(), "boom")
+	assert.Equal(t, len(errs), 1)
+
+	s.err = nil
+	sc.Add("k2", "v2-again")
+	assert.Nil(t, sc.Close())
+	assert.Equal(t, s.batches, 2)
+	assert.MapEqual(t, s.data, map[interface{}]interface{}{"k1": "v1", "k2": "v2-again"})
+}
+
+func TestStoreCacheWriteBehindFlushesPeriodically(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newTestStore()
+	sc, _ := NewStoreCache(c, s, StoreOptions{WriteBehind: true, FlushInterval: time.Millisecond})
+	defer sc.Close()
+
+	sc.Add("k1", "v1")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := s.get("k1"); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	v, ok := s.get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v1")
+}
+
+func TestStoreCacheWriteBehindFlushingWritesVisible(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newBlockingStore("delete")
+	s.data["k"] = "old"
+	sc, _ := NewStoreCache(c, s, StoreOptions{WriteBehind: true, FlushInterval: time.Hour})
+
+	sc.Remove("k")
+
+	flushed := make(chan error)
+	go func() { flushed <- sc.Flush() }()
+	<-s.entered
+
+	_, ok := sc.Get("k")
+	assert.False(t, ok)
+
+	close(s.release)
+	assert.Nil(t, <-flushed)
+
+	_, ok = sc.Get("k")
+	assert.False(t, ok)
+	assert.Nil(t, sc.Close())
+}
+
+func TestStoreCacheSerializesLoadsAndWrites(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newBlockingStore("load")
+	s.data["k"] = "old"
+	sc, _ := NewStoreCache(c, s, StoreOptions{})
+
+	got := make(chan interface{})
+	go func() {
+		v, _ := sc.Get("k")
+		got <- v
+	}()
+	<-s.entered
+
+	removed := make(chan bool)
+	go func() { removed <- sc.Remove("k") }()
+
+	close(s.release)
+	assert.Equal(t, <-got, "old")
+	assert.True(t, <-removed)
+
+	_, ok := c.Get("k")
+	assert.False(t, ok)
+	_, ok = s.get("k")
+	assert.False(t, ok)
+	assert.Equal(t, len(sc.(*storeCache).keys.locks), 0)
+}
+
+func TestStoreCacheGetMulti(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newTestStore()
+	s.data["a"] = "A"
+	s.data["b"] = "B"
+	s.data["c"] = "C"
+	var errs []error
+	sc, _ := NewStoreCache(c, testBatchStore{s}, StoreOptions{
+		WriteBehind:   true,
+		FlushInterval: time.Hour,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+	defer sc.Close()
+
+	c.Add("a", "cached")
+	sc.Add("b", "queued")
+
+	values, found := sc.GetMulti([]interface{}{"a", "b", "c", "d"})
+	assert.ArrayEqual(t, values, []interface{}{"cached", "queued", "C", nil})
+	assert.ArrayEqual(t, found, []bool{true, true, true, false})
+	assert.Equal(t, s.batches, 1)
+
+	v, ok := c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, v, "C")
+
+	c.Remove("c")
+	s.err = errors.New("boom")
+	values, found = sc.GetMulti([]interface{}{"a", "c"})
+	assert.ArrayEqual(t, values, []interface{}{"cached", nil})
+	assert.ArrayEqual(t, found, []bool{true, false})
+	assert.Equal(t, len(errs), 1)
+}
+
+func TestStoreCacheGetMultiWithoutBatchStore(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := newTestStore()
+	s.data["a"] = "A"
+	sc, _ := NewStoreCache(c, s, StoreOptions{})
+
+	values, found := sc.GetMulti([]interface{}{"a", "b"})
+	assert.ArrayEqual(t, values, []interface{}{"A", nil})
+	assert.ArrayEqual(t, found, []bool{true, false})
+	assert.Equal(t, c.Len(), 1)
+}
+
+func TestStoreCacheGetMultiDoesNotCacheOverlappingWrites(t *testing.T) {
+	c, _ := NewLRU(10)
+	s := blockingBatchStore{
+		testBatchStore{newTestStore()},
+		make(chan struct{}),
+		make(chan struct{}),
+	}
+	s.data["a"] = "old"
+	s.data["b"] = "B"
+	sc, _ := NewStoreCache(c, s, StoreOptions{})
+
+	type result struct {
+		values []interface{}
+		found  []bool
+	}
+	got := make(chan result)
+	go func() {
+		values, found := sc.GetMulti([]interface{}{"a", "b"})
+		got <- result{values, found}
+	}()
+	<-s.entered
+
+	sc.Remove("a")
+	close(s.release)
+
+	r := <-got
+	assert.ArrayEqual(t, r.values, []interface{}{"old", "B"})
+	assert.ArrayEqual(t, r.found, []bool{true, true})
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, c.Len(), 0)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+// TaggedCache is implemented by Caches whose entries may be tagged and removed as
+// a group. Caches created by NewLRU and NewTTL implement TaggedCache.
+type TaggedCache interface {
+	Cache
+
+	// AddTagged adds an item to the cache with the given tags, replacing any
+	// tags the key previously had. Adding a key with Add removes its tags.
+	// Returns true if the key already existed.
+	AddTagged(key, value interface{}, tags ...string) bool
+
+	// InvalidateTag removes every entry tagged with tag and returns the number
+	// of entries removed. Removed entries are not reported to eviction hooks.
+	InvalidateTag(tag string) int
+}
+
+// tagIndex maps tags to the keys carrying them. Caches must remove keys from the
+// index whenever their entries are removed, evicted or expire, typically from a
+// simplelru eviction callback.
+type tagIndex struct {
+	byTag map[string]map[interface{}]struct{}
+	byKey map[interface{}][]string
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		byTag: map[string]map[interface{}]struct{}{},
+		byKey: map[interface{}][]string{},
+	}
+}
+
+// set replaces the tags of key.
+func (idx *tagIndex) set(key interface{}, tags []string) {
+	idx.remove(key)
+	if len(tags) == 0 {
+		return
+	}
+
+	for _, tag := range tags {
+		keys, ok := idx.byTag[tag]
+		if !ok {
+			keys = map[interface{}]struct{}{}
+			idx.byTag[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	idx.byKey[key] = append([]string(nil), tags...)
+}
+
+// remove drops key from the index.
+func (idx *tagIndex) remove(key interface{}) {
+	for _, tag := range idx.byKey[key] {
+		keys := idx.byTag[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(idx.byTag, tag)
+		}
+	}
+	delete(idx.byKey, key)
+}
+
+// keys returns the keys tagged with tag.
+func (idx *tagIndex) keys(tag string) []interface{} {
+	result := make([]interface{}, 0, len(idx.byTag[tag]))
+	for key := range idx.byTag[tag] {
+		result = append(result, key)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+func sortedKeys(c Cache) []string {
+	result := []string{}
+	c.ForEach(func(k, _ interface{}) {
+		result = append(result, k.(string))
+	})
+	sort.Strings(result)
+	return result
+}
+
+func TestTagIndex(t *testing.T) {
+	idx := newTagIndex()
+
+	idx.set("a", []string{"x", "y"})
+	idx.set("b", []string{"y"})
+	idx.set("c", nil)
+
+	assert.HasSameElements(t, idx.keys("x"), []interface{}{"a"})
+	assert.HasSameElements(t, idx.keys("y"), []interface{}{"a", "b"})
+	assert.Equal(t, len(idx.byKey), 2)
+
+	idx.set("a", []string{"z"})
+	assert.Equal(t, len(idx.keys("x")), 0)
+	assert.HasSameElements(t, idx.keys("y"), []interface{}{"b"})
+	assert.HasSameElements(t, idx.keys("z"), []interface{}{"a"})
+
+	idx.remove("a")
+	idx.remove("b")
+	assert.Equal(t, len(idx.byTag), 0)
+	assert.Equal(t, len(idx.byKey), 0)
+}
+
+func testInvalidateTag(t *testing.T, c TaggedCache) {
+	c.AddTagged("a", 1, "tenant-1")
+	c.AddTagged("b", 2, "tenant-1", "tenant-2")
+	c.AddTagged("c", 3, "tenant-2")
+	c.Add("d", 4)
+
+	assert.Equal(t, c.InvalidateTag("tenant-1"), 2)
+	assert.ArrayEqual(t, sortedKeys(c), []string{"c", "d"})
+	assert.Equal(t, c.InvalidateTag("tenant-1"), 0)
+
+	// Re-adding without tags drops the key's tags.
+	c.Add("c", 3)
+	assert.Equal(t, c.InvalidateTag("tenant-2"), 0)
+	assert.ArrayEqual(t, sortedKeys(c), []string{"c", "d"})
+
+	// Removed and evicted keys leave the index.
+	c.AddTagged("c", 3, "tenant-3")
+	c.Remove("c")
+	c.AddTagged("e", 5, "tenant-3")
+	c.AddTagged("f", 6, "tenant-3")
+	c.AddTagged("g", 7, "tenant-3")
+	c.Get("d")
+	c.AddTagged("h", 8, "tenant-3")
+	assert.Equal(t, c.Len(), 4)
+	assert.Equal(t, c.InvalidateTag("tenant-3"), 3)
+	assert.ArrayEqual(t, sortedKeys(c), []string{"d"})
+}
+
+func TestLRUCacheInvalidateTag(t *testing.T) {
+	c, _ := NewLRU(4)
+	testInvalidateTag(t, c.(TaggedCache))
+	assert.Equal(t, len(c.(*lruCache).tags.byKey), 0)
+
+	c.(TaggedCache).AddTagged("a", 1, "x")
+	c.Clear()
+	assert.Equal(t, len(c.(*lruCache).tags.byKey), 0)
+}
+
+func TestTTLCacheInvalidateTag(t *testing.T) {
+	c, _ := NewTTL(4, time.Minute)
+	testInvalidateTag(t, c.(TaggedCache))
+	assert.Equal(t, len(c.(*ttlLruCache).tags.byKey), 0)
+}
+
+func TestTTLCacheInvalidateTagExpired(t *testing.T) {
+	c, _ := NewTTL(4, time.Minute)
+	tc := c.(TaggedCache)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		tc.AddTagged("a", 1, "x")
+		ts.Advance(time.Minute)
+		tc.AddTagged("b", 2, "x")
+
+		assert.Equal(t, tc.InvalidateTag("x"), 1)
+		assert.Equal(t, c.Len(), 0)
+		assert.Equal(t, len(c.(*ttlLruCache).tags.byKey), 0)
+
+		// Expired entries leave the index when they are removed.
+		tc.AddTagged("c", 3, "y")
+		ts.Advance(time.Minute)
+		_, ok := c.Get("c")
+		assert.False(t, ok)
+		assert.Equal(t, len(c.(*ttlLruCache).tags.byKey), 0)
+	})
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// WritePolicy determines which tiers of a tiered Cache receive writes.
+type WritePolicy int
+
+const (
+	// WriteThrough adds entries to both tiers.
+	WriteThrough WritePolicy = iota
+
+	// WriteL1Only adds entries to the first tier only, removing any existing
+	// entry for the key from the second tier so that it cannot later be read
+	// with an outdated value.
+	WriteL1Only
+)
+
+// TieredOptions configures a Cache created by NewTiered.
+type TieredOptions struct {
+	// WritePolicy determines which tiers receive writes. The default is
+	// WriteThrough.
+	WritePolicy WritePolicy
+
+	// Demote causes entries evicted from the first tier to be added to the
+	// second tier. The first tier must implement EvictionNotifier.
+	Demote bool
+}
+
+// NewTiered creates a Cache composed of a first tier, l1, typically small and
+// fast, in front of a second tier, l2, typically large or slow. Get checks l1 and
+// then l2, promoting entries found in l2 into l1. With the WriteL1Only policy,
+// promoted entries are moved out of l2. Remove and Clear apply to both tiers.
+//
+// Len and ForEach count and visit each key once, preferring the value in l1.
+// Both require iterating over each tier, so they are more expensive than for the
+// underlying caches.
+func NewTiered(l1, l2 Cache, opts TieredOptions) (Cache, error) {
+	if l1 == nil || l2 == nil {
+		return nil, errors.New("Must provide two tiers")
+	}
+
+	if opts.WritePolicy != WriteThrough && opts.WritePolicy != WriteL1Only {
+		return nil, errors.New("unknown write policy")
+	}
+
+	if opts.Demote {
+		notifier, ok := l1.(EvictionNotifier)
+		if !ok {
+			return nil, errors.New("first tier must implement EvictionNotifier to demote evictions")
+		}
+
+		notifier.AddEvictionHook(func(key, value interface{}) {
+			l2.Add(key, value)
+		})
+	}
+
+	return &tiered{l1: l1, l2: l2, policy: opts.WritePolicy}, nil
+}
+
+type tiered struct {
+	l1     Cache
+	l2     Cache
+	policy WritePolicy
+
+	// writes counts the Adds, Removes and Clears made while holding lock, so
+	// that Get can detect writes made while it read from l2.
+	writes uint64
+	lock   sync.Mutex
+}
+
+// write records a write. The caller must hold c.lock.
+func (c *tiered) write() {
+	atomic.AddUint64(&c.writes, 1)
+}
+
+// Get reads each tier without holding c.lock, so that slow reads from l2 do not
+// delay other operations, and locks only to promote an entry. The entry is not
+// promoted if the tiers were written to while l2 was read, since the value read
+// may no longer be current.
+func (c *tiered) Get(key interface{}) (interface{}, bool) {
+	if value, ok := c.l1.Get(key); ok {
+		return value, true
+	}
+
+	writes := atomic.LoadUint64(&c.writes)
+	value, ok := c.l2.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if atomic.LoadUint64(&c.writes) == writes {
+		c.l1.Add(key, value)
+		if c.policy == WriteL1Only {
+			c.l2.Remove(key)
+		}
+	}
+
+	return value, true
+}
+
+func (c *tiered) ForEach(f func(key, value interface{})) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	seen := map[interface{}]bool{}
+	c.l1.ForEach(func(key, value interface{}) {
+		seen[key] = true
+		f(key, value)
+	})
+
+	c.l2.ForEach(func(key, value interface{}) {
+		if !seen[key] {
+			f(key, value)
+		}
+	})
+}
+
+func (c *tiered) Add(key, value interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write()
+	existed := c.l1.Add(key, value)
+	if c.policy == WriteL1Only {
+		return c.l2.Remove(key) || existed
+	}
+
+	return c.l2.Add(key, value) || existed
+}
+
+func (c *tiered) Remove(key interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write()
+	removed := c.l1.Remove(key)
+	return c.l2.Remove(key) || removed
+}
+
+func (c *tiered) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write()
+	c.l1.Clear()
+	c.l2.Clear()
+}
+
+func (c *tiered) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	seen := map[interface{}]bool{}
+	c.l1.ForEach(func(key, _ interface{}) {
+		seen[key] = true
+	})
+
+	n := len(seen)
+	c.l2.ForEach(func(key, _ interface{}) {
+		if !seen[key] {
+			n++
+		}
+	})
+
+	return n
+}
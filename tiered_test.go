@@ -0,0 +1,178 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewTiered(t *testing.T) {
+	l1, _ := NewLRU(2)
+	l2, _ := NewLRU(10)
+
+	c, err := NewTiered(nil, l2, TieredOptions{})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "two tiers")
+
+	c, err = NewTiered(l1, l2, TieredOptions{WritePolicy: WritePolicy(99)})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "unknown write policy")
+
+	c, err = NewTiered(NewNoopCache(), l2, TieredOptions{Demote: true})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "must implement EvictionNotifier")
+
+	c, err = NewTiered(l1, l2, TieredOptions{WritePolicy: WriteL1Only, Demote: true})
+	assert.Nil(t, err)
+	assert.NonNil(t, c)
+	impl := c.(*tiered)
+	assert.Equal(t, impl.l1, l1)
+	assert.Equal(t, impl.l2, l2)
+	assert.Equal(t, impl.policy, WriteL1Only)
+}
+
+func TestTieredWriteThrough(t *testing.T) {
+	l1, _ := NewLRU(2)
+	l2, _ := NewLRU(10)
+	c, _ := NewTiered(l1, l2, TieredOptions{})
+
+	assert.False(t, c.Add("k1", "v1"))
+	assert.False(t, c.Add("k2", "v2"))
+	assert.False(t, c.Add("k3", "v3"))
+	assert.True(t, c.Add("k1", "v1-again"))
+	assert.Equal(t, l1.Len(), 2)
+	assert.Equal(t, l2.Len(), 3)
+	assert.Equal(t, c.Len(), 3)
+
+	// k2 was evicted from l1 and is promoted from l2
+	_, ok := l1.Get("k2")
+	assert.False(t, ok)
+	v, ok := c.Get("k2")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v2")
+	_, ok = l1.Get("k2")
+	assert.True(t, ok)
+	_, ok = l2.Get("k2")
+	assert.True(t, ok)
+
+	kvs := map[interface{}]interface{}{}
+	c.ForEach(func(k, v interface{}) { kvs[k] = v })
+	assert.MapEqual(t, kvs, map[interface{}]interface{}{
+		"k1": "v1-again",
+		"k2": "v2",
+		"k3": "v3",
+	})
+
+	assert.True(t, c.Remove("k3"))
+	assert.False(t, c.Remove("k3"))
+	assert.Equal(t, c.Len(), 2)
+
+	c.Clear()
+	assert.Equal(t, c.Len(), 0)
+	assert.Equal(t, l2.Len(), 0)
+}
+
+func TestTieredWriteL1OnlyWithDemotion(t *testing.T) {
+	l1, _ := NewLRU(2)
+	l2, _ := NewLRU(10)
+	c, _ := NewTiered(l1, l2, TieredOptions{WritePolicy: WriteL1Only, Demote: true})
+
+	c.Add("k1", "v1")
+	c.Add("k2", "v2")
+	assert.Equal(t, l2.Len(), 0)
+
+	// k1 is demoted
+	c.Add("k3", "v3")
+	assert.ArrayEqual(t, keys(l1), []interface{}{"k2", "k3"})
+	assert.ArrayEqual(t, keys(l2), []interface{}{"k1"})
+	assert.Equal(t, c.Len(), 3)
+
+	// k1 is promoted, demoting k2
+	v, ok := c.Get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v1")
+	assert.ArrayEqual(t, keys(l1), []interface{}{"k3", "k1"})
+	assert.ArrayEqual(t, keys(l2), []interface{}{"k2"})
+
+	// writes remove outdated values from l2
+	assert.True(t, c.Add("k2", "v2-again"))
+	assert.ArrayEqual(t, keys(l1), []interface{}{"k1", "k2"})
+	assert.ArrayEqual(t, keys(l2), []interface{}{"k3"})
+
+	v, ok = c.Get("k2")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v2-again")
+}
+
+func TestTieredWithoutDemotion(t *testing.T) {
+	l1, _ := NewLRU(2)
+	l2, _ := NewLRU(10)
+	c, _ := NewTiered(l1, l2, TieredOptions{WritePolicy: WriteL1Only})
+
+	c.Add("k1", "v1")
+	c.Add("k2", "v2")
+	c.Add("k3", "v3")
+	assert.Equal(t, l2.Len(), 0)
+
+	_, ok := c.Get("k1")
+	assert.False(t, ok)
+}
+
+type getHookCache struct {
+	Cache
+	onGet func(key interface{})
+}
+
+func (c *getHookCache) Get(key interface{}) (interface{}, bool) {
+	value, ok := c.Cache.Get(key)
+	c.onGet(key)
+	return value, ok
+}
+
+func TestTieredGetLocksOnlyToPromote(t *testing.T) {
+	l1, _ := NewLRU(2)
+	lru, _ := NewLRU(10)
+	l2 := &getHookCache{Cache: lru, onGet: func(interface{}) {}}
+	c, _ := NewTiered(l1, l2, TieredOptions{})
+	impl := c.(*tiered)
+
+	c.Add("k1", "v1")
+
+	impl.lock.Lock()
+	v, ok := c.Get("k1")
+	impl.lock.Unlock()
+	assert.True(t, ok)
+	assert.Equal(t, v, "v1")
+
+	// A write made while l2 is read prevents promotion of the value read.
+	lru.Add("k2", "v2")
+	l2.onGet = func(key interface{}) { c.Remove(key) }
+	v, ok = c.Get("k2")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v2")
+	assert.False(t, l1.Remove("k2"))
+	assert.Equal(t, c.Len(), 1)
+
+	l2.onGet = func(interface{}) {}
+	lru.Add("k3", "v3")
+	v, ok = c.Get("k3")
+	assert.True(t, ok)
+	assert.Equal(t, v, "v3")
+	assert.True(t, l1.Remove("k3"))
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+	"strings"
+)
+
+// keyTrie indexes string keys by prefix. It is a radix tree: each node's edge is
+// labeled with the longest substring its keys share, so the tree has at most
+// twice as many nodes as keys. A nil *keyTrie indexes nothing, allowing caches to
+// build their index only once it is needed.
+type keyTrie struct {
+	root trieNode
+}
+
+type trieNode struct {
+	// label is the substring of the keys below the node that follows its
+	// parent's keys.
+	label string
+
+	// children is sorted by the first byte of their labels, which are
+	// distinct.
+	children []*trieNode
+	present  bool
+}
+
+func newKeyTrie() *keyTrie {
+	return &keyTrie{}
+}
+
+// indexKeys returns *t, first setting it to an index of the keys passed to f by
+// forEach if it is nil. Caches call it when first searched by prefix, so that those
+// never searched by prefix leave *t nil and do not maintain an index.
+func indexKeys(t **keyTrie, forEach func(f func(key interface{}))) *keyTrie {
+	if *t == nil {
+		*t = newKeyTrie()
+		forEach((*t).insertKey)
+	}
+
+	return *t
+}
+
+// child returns the index of the child whose label begins with b, or where such a
+// child would be inserted, and the child, if any.
+func (n *trieNode) child(b byte) (int, *trieNode) {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label[0] >= b })
+	if i < len(n.children) && n.children[i].label[0] == b {
+		return i, n.children[i]
+	}
+
+	return i, nil
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (t *keyTrie) insert(key string) {
+	if t == nil {
+		return
+	}
+
+	n := &t.root
+	for len(key) > 0 {
+		i, child := n.child(key[0])
+		if child == nil {
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = &trieNode{label: key, present: true}
+			return
+		}
+
+		common := commonPrefixLen(child.label, key)
+		if common < len(child.label) {
+			// Split the edge where key diverges from it.
+			split := &trieNode{label: child.label[:common], children: []*trieNode{child}}
+			child.label = child.label[common:]
+			n.children[i] = split
+			child = split
+		}
+
+		key = key[common:]
+		n = child
+	}
+	n.present = true
+}
+
+func (t *keyTrie) remove(key string) {
+	if t != nil {
+		t.root.remove(key)
+	}
+}
+
+// remove unmarks key relative to n, pruning the nodes it leaves empty and merging
+// those left with a single child into it.
+func (n *trieNode) remove(key string) {
+	if len(key) == 0 {
+		n.present = false
+		return
+	}
+
+	i, child := n.child(key[0])
+	if child == nil || !strings.HasPrefix(key, child.label) {
+		return
+	}
+
+	child.remove(key[len(child.label):])
+	if child.present {
+		return
+	}
+
+	switch len(child.children) {
+	case 0:
+		n.children = append(n.children[:i], n.children[i+1:]...)
+	case 1:
+		grandchild := child.children[0]
+		grandchild.label = child.label + grandchild.label
+		n.children[i] = grandchild
+	}
+}
+
+// insertKey indexes key if it is a string.
+func (t *keyTrie) insertKey(key interface{}) {
+	if s, ok := key.(string); ok {
+		t.insert(s)
+	}
+}
+
+// removeKey removes key from the index if it is a string.
+func (t *keyTrie) removeKey(key interface{}) {
+	if s, ok := key.(string); ok {
+		t.remove(s)
+	}
+}
+
+// withPrefix returns the indexed keys beginning with prefix in lexical order.
+func (t *keyTrie) withPrefix(prefix string) []string {
+	if t == nil {
+		return nil
+	}
+
+	n := &t.root
+	path := ""
+	for len(prefix) > 0 {
+		_, child := n.child(prefix[0])
+		switch {
+		case child == nil:
+			return nil
+		case strings.HasPrefix(prefix, child.label):
+			prefix = prefix[len(child.label):]
+		case strings.HasPrefix(child.label, prefix):
+			prefix = ""
+		default:
+			return nil
+		}
+
+		path += child.label
+		n = child
+	}
+
+	var result []string
+	n.collect(path, &result)
+	return result
+}
+
+func (n *trieNode) collect(path string, result *[]string) {
+	if n.present {
+		*result = append(*result, path)
+	}
+
+	for _, child := range n.children {
+		child.collect(path+child.label, result)
+	}
+}
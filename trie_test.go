@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestKeyTrie(t *testing.T) {
+	trie := newKeyTrie()
+
+	for _, key := range []string{"a/b", "a/c", "a", "b/a", ""} {
+		trie.insert(key)
+	}
+	trie.insertKey(1)
+
+	assert.ArrayEqual(t, trie.withPrefix("a/"), []string{"a/b", "a/c"})
+	assert.ArrayEqual(t, trie.withPrefix("a"), []string{"a", "a/b", "a/c"})
+	assert.ArrayEqual(t, trie.withPrefix(""), []string{"", "a", "a/b", "a/c", "b/a"})
+	assert.Equal(t, len(trie.withPrefix("c")), 0)
+
+	trie.remove("a/b")
+	trie.removeKey("a")
+	trie.remove("missing")
+	assert.ArrayEqual(t, trie.withPrefix("a"), []string{"a/c"})
+
+	trie.remove("a/c")
+	trie.remove("b/a")
+	trie.remove("")
+	assert.Equal(t, len(trie.root.children), 0)
+	assert.False(t, trie.root.present)
+}
+
+func TestKeyTrieSplitsAndMergesEdges(t *testing.T) {
+	trie := newKeyTrie()
+
+	trie.insert("user/10")
+	trie.insert("user/1")
+	trie.insert("user/2")
+	trie.insert("users")
+	assert.Equal(t, len(trie.root.children), 1)
+	assert.Equal(t, trie.root.children[0].label, "user")
+
+	assert.ArrayEqual(t, trie.withPrefix("use"), []string{"user/1", "user/10", "user/2", "users"})
+	assert.ArrayEqual(t, trie.withPrefix("user/1"), []string{"user/1", "user/10"})
+	assert.Equal(t, len(trie.withPrefix("user/3")), 0)
+	assert.Equal(t, len(trie.withPrefix("user/100")), 0)
+
+	trie.remove("user/1")
+	trie.remove("user/2")
+	trie.remove("users")
+	assert.Equal(t, len(trie.root.children), 1)
+	assert.Equal(t, trie.root.children[0].label, "user/10")
+	assert.ArrayEqual(t, trie.withPrefix("u"), []string{"user/10"})
+
+	var nilTrie *keyTrie
+	nilTrie.insert("a")
+	nilTrie.removeKey("a")
+	assert.Equal(t, len(nilTrie.withPrefix("")), 0)
+}
+
+func TestIndexKeys(t *testing.T) {
+	var trie *keyTrie
+	calls := 0
+	forEach := func(f func(key interface{})) {
+		calls++
+		for _, key := range []interface{}{"b", 1, "a"} {
+			f(key)
+		}
+	}
+
+	index := indexKeys(&trie, forEach)
+	assert.True(t, index == trie)
+	assert.ArrayEqual(t, trie.withPrefix(""), []string{"a", "b"})
+
+	trie.insertKey("c")
+	assert.True(t, indexKeys(&trie, forEach) == index)
+	assert.ArrayEqual(t, trie.withPrefix(""), []string{"a", "b", "c"})
+	assert.Equal(t, calls, 1)
+}
@@ -18,6 +18,8 @@ package cache
 
 import (
 	"errors"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -27,8 +29,131 @@ import (
 )
 
 type entry struct {
-	deadline time.Time
-	value    interface{}
+	stale      time.Time
+	deadline   time.Time
+	value      interface{}
+	negative   bool
+	err        error
+	added      time.Time
+	accesses   int
+	lastAccess time.Time
+	retention
+}
+
+// DefaultRefreshWorkers is the maximum number of concurrent refreshes performed
+// by a TTL cache if no other limit is configured.
+const DefaultRefreshWorkers = 8
+
+// Loader loads the value for a key, typically from the source that a Cache is in
+// front of.
+type Loader func(key interface{}) (interface{}, error)
+
+// LookupStatus describes the result of TTLCache.Lookup.
+type LookupStatus int
+
+const (
+	// LookupMiss indicates that the key was not found.
+	LookupMiss LookupStatus = iota
+
+	// LookupHit indicates that the key was found.
+	LookupHit
+
+	// LookupStale indicates that the key was found but its TTL has passed. The
+	// entry is served until its hard TTL passes.
+	LookupStale
+
+	// LookupNegative indicates that the key was found but was added with
+	// AddNegative: it is known to be absent from the underlying source, or
+	// loading it failed.
+	LookupNegative
+)
+
+// Lookup is the result of TTLCache.Lookup.
+type Lookup struct {
+	Value  interface{}
+	Status LookupStatus
+
+	// Err is the error cached for a negative entry. It is nil for other
+	// statuses, and for negative entries that record absence.
+	Err error
+}
+
+// TTLCache is a Cache whose entries expire. Caches created by NewTTL implement
+// TTLCache.
+type TTLCache interface {
+	Cache
+
+	// Lookup retrieves an item from the cache, reporting whether it was found
+	// and whether it is stale. Like Get, it marks the key as the most recently
+	// used and may trigger a refresh of a stale entry.
+	Lookup(key interface{}) Lookup
+
+	// AddNegative caches the absence of key, or err if loading key failed, for
+	// the cache's negative TTL. Get treats negative entries as misses and
+	// ForEach skips them, but Lookup reports them with the LookupNegative
+	// status. Returns true if an existing entry was replaced.
+	AddNegative(key interface{}, err error) bool
+
+	// RefreshStats returns counts of the background refreshes performed by the
+	// cache.
+	RefreshStats() RefreshStats
+}
+
+// RefreshStats counts the background refreshes performed by a TTLCache.
+type RefreshStats struct {
+	// Started is the number of refreshes started.
+	Started uint64
+
+	// Succeeded is the number of refreshes that replaced an entry.
+	Succeeded uint64
+
+	// Failed is the number of refreshes whose Loader returned an error.
+	Failed uint64
+
+	// Dropped is the number of refreshes not started because every refresh
+	// worker was busy.
+	Dropped uint64
+}
+
+// TTLOptions configures optional behavior of a Cache created by
+// NewTTLWithOptions.
+type TTLOptions struct {
+	// HardTTL, if greater than the TTL, enables serving stale entries. Once an
+	// entry's TTL passes, Get continues to return it, and Lookup reports it as
+	// stale, until its HardTTL passes.
+	HardTTL time.Duration
+
+	// Loader, if non-nil, is used to refresh stale entries. The first Get or
+	// Lookup of a stale entry invokes Loader asynchronously, and a successful
+	// load replaces the entry, resetting its TTLs. If loading fails, the stale
+	// entry remains and the next Get or Lookup retries.
+	Loader Loader
+
+	// RefreshAhead, if positive, is the fraction of the TTL before an entry
+	// becomes stale during which a Get or Lookup of the entry refreshes it using
+	// Loader. Entries accessed frequently are thereby replaced before they
+	// expire. It must be less than 1 and requires a Loader.
+	RefreshAhead float64
+
+	// RefreshWorkers limits the number of refreshes performed concurrently.
+	// Refreshes needed while every worker is busy are dropped and retried on a
+	// later access. If zero, DefaultRefreshWorkers is used.
+	RefreshWorkers int
+
+	// NegativeTTL is the TTL of entries added with AddNegative. Negative entries
+	// are never served stale or refreshed. If zero, the cache's TTL is used.
+	NegativeTTL time.Duration
+
+	// Jitter, if positive, randomizes the TTL of each entry added or refreshed
+	// to a duration in the range [TTL - Jitter, TTL], so that entries added
+	// together do not expire together. The hard TTL is shortened by the same
+	// amount. Jitter must be less than the TTL and does not apply to negative
+	// entries.
+	Jitter time.Duration
+
+	// MaxPinned limits the number of pinned entries. If zero, up to the
+	// cache's size may be pinned.
+	MaxPinned int
 }
 
 // NewTTL create a new cache with a maximum size and a TTL for cache entries. When
@@ -37,29 +162,150 @@ type entry struct {
 // entry. Invocations of ForEach do not modify the LRU eviction list but expired
 // items are never returned from ForEach.
 func NewTTL(size int, ttl time.Duration) (Cache, error) {
-	underlying, err := lru.NewLRU(size, nil)
+	c, err := NewTTLWithOptions(size, ttl, TTLOptions{})
 	if err != nil {
 		return nil, err
 	}
 
+	return c, nil
+}
+
+// NewTTLWithOptions creates a new cache with a maximum size and a TTL for cache
+// entries, as NewTTL does, with additional behavior configured by opts.
+func NewTTLWithOptions(size int, ttl time.Duration, opts TTLOptions) (TTLCache, error) {
 	if ttl <= 0 {
 		return nil, errors.New("Must provide a positive TTL")
 	}
 
-	return &ttlLruCache{
-		lru:        underlying,
-		size:       size,
-		ttl:        ttl,
-		timeSource: tbntime.NewSource(),
-	}, nil
+	if opts.RefreshAhead < 0 || opts.RefreshAhead >= 1 {
+		return nil, errors.New("refresh ahead fraction must be in the range [0, 1)")
+	}
+
+	if opts.RefreshAhead > 0 && opts.Loader == nil {
+		return nil, errors.New("Must provide a Loader to refresh ahead")
+	}
+
+	if opts.RefreshWorkers < 0 {
+		return nil, errors.New("Must provide a non-negative number of refresh workers")
+	}
+
+	if opts.Jitter < 0 || opts.Jitter >= ttl {
+		return nil, errors.New("jitter must be non-negative and less than the TTL")
+	}
+
+	if opts.MaxPinned < 0 {
+		return nil, errors.New("Must provide a non-negative maximum number of pinned entries")
+	}
+
+	if opts.NegativeTTL < 0 {
+		return nil, errors.New("Must provide a non-negative negative TTL")
+	}
+
+	if opts.NegativeTTL == 0 {
+		opts.NegativeTTL = ttl
+	}
+
+	if opts.RefreshWorkers == 0 {
+		opts.RefreshWorkers = DefaultRefreshWorkers
+	}
+
+	hardTTL := ttl
+	if opts.HardTTL > ttl {
+		hardTTL = opts.HardTTL
+	}
+
+	c := &ttlLruCache{
+		size:         size,
+		ttl:          ttl,
+		hardTTL:      hardTTL,
+		refreshAhead: time.Duration(opts.RefreshAhead * float64(ttl)),
+		loader:       opts.Loader,
+		refreshing:   map[interface{}]bool{},
+		negativeTTL:  opts.NegativeTTL,
+		jitter:       opts.Jitter,
+		retention:    retentionCounts{maxPinned: opts.MaxPinned},
+		tags:         newTagIndex(),
+		workers:      make(chan struct{}, opts.RefreshWorkers),
+		timeSource:   tbntime.NewSource(),
+	}
+
+	underlying, err := lru.NewLRU(size, c.onEvict)
+	if err != nil {
+		return nil, err
+	}
+	c.lru = underlying
+
+	return c, nil
 }
 
 type ttlLruCache struct {
-	lru        *lru.LRU
-	lock       sync.Mutex
-	size       int
-	ttl        time.Duration
-	timeSource tbntime.Source
+	lru          *lru.LRU
+	lock         sync.Mutex
+	size         int
+	ttl          time.Duration
+	hardTTL      time.Duration
+	refreshAhead time.Duration
+	negativeTTL  time.Duration
+	jitter       time.Duration
+	retention    retentionCounts
+	rng          *rand.Rand
+	tags         *tagIndex
+	prefixes     *keyTrie
+	hooks        evictionHooks
+	loader       Loader
+	refreshing   map[interface{}]bool
+	workers      chan struct{}
+	stats        RefreshStats
+	timeSource   tbntime.Source
+}
+
+// onEvict keeps the cache's indexes and pinned count consistent with the contents
+// of the LRU.
+func (c *ttlLruCache) onEvict(key, value interface{}) {
+	c.tags.remove(key)
+	c.prefixes.removeKey(key)
+	c.retention.forget(&value.(*entry).retention)
+}
+
+// put stores e for key, which must already be present or have room. The entry
+// keeps its pin and priority, if any; add then sets the priority it is given,
+// while other writes retain it.
+func (c *ttlLruCache) put(key interface{}, e *entry) {
+	if v, ok := c.lru.Peek(key); ok {
+		e.retention = v.(*entry).retention
+	}
+
+	c.lru.Add(key, e)
+}
+
+func (c *ttlLruCache) newEntry(value interface{}) *entry {
+	now := c.timeSource.Now()
+	start := now
+	if c.jitter > 0 {
+		// Seed lazily so that tests controlling the time source get a
+		// deterministic sequence.
+		if c.rng == nil {
+			c.rng = rand.New(rand.NewSource(now.UnixNano()))
+		}
+		start = now.Add(-time.Duration(c.rng.Int63n(int64(c.jitter) + 1)))
+	}
+
+	return &entry{
+		stale:    start.Add(c.ttl),
+		deadline: start.Add(c.hardTTL),
+		value:    value,
+		added:    now,
+	}
+}
+
+func (c *ttlLruCache) newNegativeEntry(err error) *entry {
+	now := c.timeSource.Now()
+	deadline := now.Add(c.negativeTTL)
+	return &entry{stale: deadline, deadline: deadline, negative: true, err: err, added: now}
+}
+
+func (c *ttlLruCache) isStale(e *entry) bool {
+	return !c.timeSource.Now().Before(e.stale)
 }
 
 func (c *ttlLruCache) expired(e *entry) bool {
@@ -67,34 +313,399 @@ func (c *ttlLruCache) expired(e *entry) bool {
 }
 
 func (c *ttlLruCache) Add(key, value interface{}) bool {
+	return c.AddTagged(key, value)
+}
+
+func (c *ttlLruCache) AddTagged(key, value interface{}, tags ...string) bool {
+	c.lock.Lock()
+	exists, evicted, _ := c.add(key, c.newEntry(value), tags, DefaultPriority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return exists
+}
+
+// live returns the entry for key if it is present, has not expired and is not
+// negative, without marking it as recently used.
+func (c *ttlLruCache) live(key interface{}) (*entry, bool) {
+	if entry, ok := c.getEntry(key, true); ok && !entry.negative {
+		return entry, true
+	}
+
+	return nil, false
+}
+
+func (c *ttlLruCache) Peek(key interface{}) (interface{}, bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if entry, ok := c.live(key); ok {
+		return entry.value, true
+	}
+
+	return nil, false
+}
+
+func (c *ttlLruCache) Contains(key interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, ok := c.live(key)
+	return ok
+}
+
+func (c *ttlLruCache) GetEntry(key interface{}) (EntryInfo, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.live(key)
+	if !ok {
+		return EntryInfo{}, false
+	}
+
+	return EntryInfo{
+		Value:      entry.value,
+		Added:      entry.added,
+		Deadline:   entry.deadline,
+		TTL:        entry.deadline.Sub(c.timeSource.Now()),
+		Accesses:   entry.accesses,
+		LastAccess: entry.lastAccess,
+	}, true
+}
+
+func (c *ttlLruCache) AddIfAbsent(key, value interface{}) bool {
+	c.lock.Lock()
+	if _, ok := c.live(key); ok {
+		c.lock.Unlock()
+		return false
+	}
+
+	_, evicted, err := c.add(key, c.newEntry(value), nil, DefaultPriority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return err == nil
+}
+
+func (c *ttlLruCache) Replace(key, value interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.live(key); !ok {
+		return false
+	}
+
+	c.put(key, c.newEntry(value))
+	return true
+}
+
+func (c *ttlLruCache) CompareAndSwap(key, old, new interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if entry, ok := c.live(key); !ok || !equalValues(entry.value, old) {
+		return false
+	}
+
+	c.put(key, c.newEntry(new))
+	return true
+}
+
+func (c *ttlLruCache) Compute(
+	key interface{},
+	f func(old interface{}, exists bool) (interface{}, bool),
+) (interface{}, bool) {
+	c.lock.Lock()
+	var old interface{}
+	entry, exists := c.live(key)
+	if exists {
+		old = entry.value
+	}
+	value, keep := f(old, exists)
+
+	var (
+		evicted []evictedEntry
+		err     error
+	)
+	switch {
+	case !keep:
+		c.lru.Remove(key)
+	case exists:
+		c.put(key, c.newEntry(value))
+	default:
+		_, evicted, err = c.add(key, c.newEntry(value), nil, DefaultPriority)
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return value, keep && err == nil
+}
+
+func (c *ttlLruCache) GetMulti(keys []interface{}) ([]interface{}, []bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	values := make([]interface{}, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		l := c.lookup(key)
+		values[i], found[i] = l.Value, l.Status == LookupHit || l.Status == LookupStale
+	}
+
+	return values, found
+}
+
+func (c *ttlLruCache) AddMulti(entries []KeyValue) []bool {
+	c.lock.Lock()
+	existed := make([]bool, len(entries))
+	var evicted []evictedEntry
+	for i, e := range entries {
+		var ev []evictedEntry
+		existed[i], ev, _ = c.add(e.Key, c.newEntry(e.Value), nil, DefaultPriority)
+		evicted = append(evicted, ev...)
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return existed
+}
+
+func (c *ttlLruCache) RemoveMulti(keys []interface{}) []bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	removed := make([]bool, len(keys))
+	for i, key := range keys {
+		if _, ok := c.getEntry(key, false); ok {
+			removed[i] = c.lru.Remove(key)
+		}
+	}
+
+	return removed
+}
+
+func (c *ttlLruCache) AddNegative(key interface{}, err error) bool {
+	c.lock.Lock()
+	exists, evicted, _ := c.add(key, c.newNegativeEntry(err), nil, DefaultPriority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return exists
+}
+
+// add stores e for key with the given tags and priority, making room for it if
+// necessary. Returns whether key was present and the live entries evicted, if any,
+// or ErrAllPinned if no room could be made.
+func (c *ttlLruCache) add(
+	key interface{},
+	e *entry,
+	tags []string,
+	priority int,
+) (bool, []evictedEntry, error) {
 	_, exists := c.getEntry(key, false)
-	if c.lru.Len() >= c.size && !exists {
-		// Look for expired entries to evict to avoid
-		// potentially evicting a live entry.
-		keys := c.lru.Keys()
-		for _, key := range keys {
-			if v, ok := c.lru.Peek(key); ok {
-				entry := v.(*entry)
-				if c.expired(entry) {
-					c.lru.Remove(key)
-					break
-				}
+	evicted, err := c.makeRoom(exists)
+	if err != nil {
+		return false, nil, err
+	}
+
+	c.put(key, e)
+	c.retention.setPriority(&e.retention, priority)
+	c.tags.set(key, tags)
+	c.prefixes.insertKey(key)
+	return exists, evicted, nil
+}
+
+func (c *ttlLruCache) AddWithPriority(key, value interface{}, priority int) (bool, error) {
+	c.lock.Lock()
+	exists, evicted, err := c.add(key, c.newEntry(value), nil, priority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return exists, err
+}
+
+func (c *ttlLruCache) TryAdd(key, value interface{}) (bool, error) {
+	c.lock.Lock()
+	exists, evicted, err := c.add(key, c.newEntry(value), nil, DefaultPriority)
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return exists, err
+}
+
+func (c *ttlLruCache) AddPinned(key, value interface{}) error {
+	c.lock.Lock()
+	if e, ok := c.live(key); !c.retention.canPin(ok && e.pinned, c.size) {
+		c.lock.Unlock()
+		return ErrPinLimit
+	}
+
+	e := c.newEntry(value)
+	_, evicted, err := c.add(key, e, nil, DefaultPriority)
+	if err == nil {
+		c.retention.pin(&e.retention)
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return err
+}
+
+func (c *ttlLruCache) Pin(key interface{}) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.live(key)
+	switch {
+	case !ok:
+		return false, nil
+	case !c.retention.canPin(e.pinned, c.size):
+		return true, ErrPinLimit
+	}
+
+	c.retention.pin(&e.retention)
+	return true, nil
+}
+
+func (c *ttlLruCache) Unpin(key interface{}) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.live(key)
+	return ok && c.retention.unpin(&e.retention)
+}
+
+func (c *ttlLruCache) InvalidateTag(tag string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	n := 0
+	for _, key := range c.tags.keys(tag) {
+		if _, ok := c.getEntry(key, true); ok {
+			c.lru.Remove(key)
+			n++
+		}
+	}
+
+	return n
+}
+
+// makeRoom evicts an entry if the cache is full and a new key is being added. An
+// expired entry is evicted if possible, to avoid evicting a live entry. Returns the
+// live entries evicted, if any, or ErrAllPinned if every entry is pinned.
+func (c *ttlLruCache) makeRoom(exists bool) ([]evictedEntry, error) {
+	if c.lru.Len() < c.size || exists {
+		return nil, nil
+	}
+
+	// Look for expired entries to evict to avoid
+	// potentially evicting a live entry.
+	keys := c.lru.Keys()
+	for _, key := range keys {
+		if v, ok := c.lru.Peek(key); ok {
+			entry := v.(*entry)
+			if c.expired(entry) {
+				c.lru.Remove(key)
+				return nil, nil
 			}
 		}
 	}
 
-	c.lru.Add(key, &entry{c.timeSource.Now().Add(c.ttl), value})
-	return exists
+	evicted, ok := c.evictOldest()
+	if !ok {
+		return nil, ErrAllPinned
+	}
+
+	return evicted, nil
+}
+
+// evictOldest removes the entry chosen by retentionCounts.victim. Returns the
+// entry if it is live and not negative, and false if every entry is pinned.
+func (c *ttlLruCache) evictOldest() ([]evictedEntry, bool) {
+	key, ok := c.retention.victim(c.lru)
+	if !ok {
+		return nil, false
+	}
+
+	v, _ := c.lru.Peek(key)
+	c.lru.Remove(key)
+	if e := v.(*entry); !e.negative && !c.expired(e) {
+		return []evictedEntry{{key, e.value}}, true
+	}
+
+	return nil, true
+}
+
+// livePinned returns the number of pinned entries that have not expired.
+func (c *ttlLruCache) livePinned() int {
+	n := 0
+	for _, key := range c.lru.Keys() {
+		if v, _ := c.lru.Peek(key); v.(*entry).pinned && !c.expired(v.(*entry)) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Resize changes the maximum number of entries in the cache. When shrinking,
+// expired entries are evicted before live ones.
+func (c *ttlLruCache) Resize(size int) error {
+	if size <= 0 {
+		return errors.New("Must provide a positive size")
+	}
+
+	c.lock.Lock()
+	if size < c.retention.pinned && size < c.livePinned() {
+		c.lock.Unlock()
+		return ErrAllPinned
+	}
+
+	for _, key := range c.lru.Keys() {
+		if c.lru.Len() <= size {
+			break
+		}
+
+		if v, ok := c.lru.Peek(key); ok && c.expired(v.(*entry)) {
+			c.lru.Remove(key)
+		}
+	}
+
+	var evicted []evictedEntry
+	for c.lru.Len() > size {
+		e, _ := c.evictOldest()
+		evicted = append(evicted, e...)
+	}
+
+	c.lru = resizeLRU(c.lru, size, c.onEvict)
+	c.size = size
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+	return nil
+}
+
+func (c *ttlLruCache) AddEvictionHook(h EvictionHook) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.hooks = c.hooks.add(h)
 }
 
 func (c *ttlLruCache) Remove(key interface{}) bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	if _, ok := c.get(key); ok {
+	if _, ok := c.getEntry(key, false); ok {
 		return c.lru.Remove(key)
 	}
 
@@ -105,7 +716,86 @@ func (c *ttlLruCache) Get(key interface{}) (interface{}, bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	return c.get(key)
+	l := c.lookup(key)
+	return l.Value, l.Status == LookupHit || l.Status == LookupStale
+}
+
+func (c *ttlLruCache) Lookup(key interface{}) Lookup {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lookup(key)
+}
+
+func (c *ttlLruCache) lookup(key interface{}) Lookup {
+	entry, ok := c.getEntry(key, false)
+	if !ok {
+		return Lookup{Status: LookupMiss}
+	}
+
+	entry.accesses++
+	entry.lastAccess = c.timeSource.Now()
+
+	if entry.negative {
+		return Lookup{Status: LookupNegative, Err: entry.err}
+	}
+
+	if c.isStale(entry) {
+		c.refresh(key, entry)
+		return Lookup{Value: entry.value, Status: LookupStale}
+	}
+
+	if c.refreshAhead > 0 && !c.timeSource.Now().Before(entry.stale.Add(-c.refreshAhead)) {
+		c.refresh(key, entry)
+	}
+
+	return Lookup{Value: entry.value, Status: LookupHit}
+}
+
+// refresh starts an asynchronous load of key, unless one is in progress, there is
+// no Loader, or all refresh workers are busy.
+func (c *ttlLruCache) refresh(key interface{}, e *entry) {
+	if c.loader == nil || c.refreshing[key] {
+		return
+	}
+
+	select {
+	case c.workers <- struct{}{}:
+		c.refreshing[key] = true
+		c.stats.Started++
+		go c.load(key, e)
+	default:
+		c.stats.Dropped++
+	}
+}
+
+// load invokes the Loader for key and replaces e, the entry being refreshed, with
+// the result. If e was removed, replaced or expired while loading, the result is
+// discarded.
+func (c *ttlLruCache) load(key interface{}, e *entry) {
+	value, err := c.loader(key)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	<-c.workers
+	delete(c.refreshing, key)
+	if err != nil {
+		c.stats.Failed++
+		return
+	}
+
+	if v, ok := c.lru.Peek(key); ok && v.(*entry) == e && !c.expired(e) {
+		c.put(key, c.newEntry(value))
+		c.stats.Succeeded++
+	}
+}
+
+func (c *ttlLruCache) RefreshStats() RefreshStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.stats
 }
 
 // ForEach iterates over the non-expired key-value pairs in the Cache from least to
@@ -115,18 +805,56 @@ func (c *ttlLruCache) ForEach(f func(key, value interface{})) {
 	defer c.lock.Unlock()
 
 	for _, key := range c.lru.Keys() {
-		if entry, ok := c.getEntry(key, true); ok {
+		if entry, ok := c.getEntry(key, true); ok && !entry.negative {
 			f(key, entry.value)
 		}
 	}
 }
 
-func (c *ttlLruCache) get(key interface{}) (interface{}, bool) {
-	if entry, ok := c.getEntry(key, false); ok {
-		return entry.value, true
+func (c *ttlLruCache) Range(f func(key, value interface{}) bool) {
+	c.RangeWithOptions(RangeOptions{}, f)
+}
+
+func (c *ttlLruCache) RangeWithOptions(opts RangeOptions, f func(key, value interface{}) bool) {
+	c.lock.Lock()
+	var (
+		entries   []KeyValue
+		deadlines []time.Time
+	)
+	for _, key := range c.lru.Keys() {
+		if entry, ok := c.getEntry(key, true); ok && !entry.negative {
+			entries = append(entries, KeyValue{key, entry.value})
+			deadlines = append(deadlines, entry.deadline)
+		}
 	}
 
-	return nil, false
+	switch opts.Order {
+	case NewestFirst:
+		reverseEntries(entries)
+	case ExpiringFirst:
+		sort.Stable(byDeadline{entries, deadlines})
+	}
+
+	if opts.Snapshot {
+		c.lock.Unlock()
+	} else {
+		defer c.lock.Unlock()
+	}
+
+	rangeEntries(entries, f)
+}
+
+// byDeadline sorts entries by their corresponding deadlines.
+type byDeadline struct {
+	entries   []KeyValue
+	deadlines []time.Time
+}
+
+func (s byDeadline) Len() int           { return len(s.entries) }
+func (s byDeadline) Less(i, j int) bool { return s.deadlines[i].Before(s.deadlines[j]) }
+func (s byDeadline) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+	s.deadlines[i], s.deadlines[j] = s.deadlines[j], s.deadlines[i]
 }
 
 func (c *ttlLruCache) getEntry(key interface{}, peek bool) (*entry, bool) {
@@ -161,9 +889,122 @@ func (c *ttlLruCache) Len() int {
 	return c.lru.Len()
 }
 
+func (c *ttlLruCache) RemoveIf(pred func(key, value interface{}) bool) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	n := 0
+	for _, key := range c.lru.Keys() {
+		if entry, ok := c.getEntry(key, true); ok && !entry.negative && pred(key, entry.value) {
+			c.lru.Remove(key)
+			n++
+		}
+	}
+
+	return n
+}
+
+func (c *ttlLruCache) RemovePrefix(prefix string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	index := indexKeys(&c.prefixes, func(f func(key interface{})) {
+		for _, key := range c.lru.Keys() {
+			f(key)
+		}
+	})
+
+	n := 0
+	for _, key := range index.withPrefix(prefix) {
+		if entry, ok := c.getEntry(key, true); ok && !entry.negative {
+			c.lru.Remove(key)
+			n++
+		}
+	}
+
+	return n
+}
+
 func (c *ttlLruCache) Clear() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
 	c.lru.Purge()
 }
+
+func (c *ttlLruCache) snapshot() []snapshotEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	keys := c.lru.Keys()
+	entries := make([]snapshotEntry, 0, len(keys))
+	for _, key := range keys {
+		if entry, ok := c.getEntry(key, true); ok && !entry.negative {
+			e := snapshotEntry{Key: key, Value: entry.value, Deadline: entry.deadline}
+			if entry.stale.Before(entry.deadline) {
+				e.Stale = entry.stale
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// restore adds entries with their original deadlines, limited to the cache's TTLs.
+func (c *ttlLruCache) restore(entries []snapshotEntry) {
+	c.lock.Lock()
+
+	now := c.timeSource.Now()
+	maxStale := now.Add(c.ttl)
+	maxDeadline := now.Add(c.hardTTL)
+
+	var evicted []evictedEntry
+	for _, e := range entries {
+		restored, ok := c.restoredEntry(e, now, maxStale, maxDeadline)
+		if !ok {
+			continue
+		}
+
+		if _, ev, err := c.add(e.Key, restored, nil, DefaultPriority); err == nil {
+			evicted = append(evicted, ev...)
+		}
+	}
+	hooks := c.hooks
+	c.lock.Unlock()
+
+	hooks.notify(evicted)
+}
+
+// restoredEntry converts e to an entry whose stale time and deadline are at most
+// maxStale and maxDeadline. Returns false if e has expired.
+func (c *ttlLruCache) restoredEntry(
+	e snapshotEntry,
+	now time.Time,
+	maxStale time.Time,
+	maxDeadline time.Time,
+) (*entry, bool) {
+	if e.Deadline.IsZero() {
+		// The entry came from a cache without expiration.
+		return c.newEntry(e.Value), true
+	}
+
+	if !now.Before(e.Deadline) {
+		return nil, false
+	}
+
+	stale := e.Stale
+	if stale.IsZero() {
+		stale = e.Deadline
+	}
+	if stale.After(maxStale) {
+		stale = maxStale
+	}
+
+	deadline := e.Deadline
+	if deadline.After(maxDeadline) {
+		deadline = maxDeadline
+	}
+
+	return &entry{stale: stale, deadline: deadline, value: e.Value, added: now}, true
+}
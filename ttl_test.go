@@ -17,6 +17,7 @@ limitations under the License.
 package cache
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -213,3 +214,528 @@ func TestTTLCacheExpiryInForEach(t *testing.T) {
 		assert.ArrayEqual(t, keys, []int{3, 2})
 	})
 }
+
+func TestTTLCacheEvictionHook(t *testing.T) {
+	c, err := NewTTL(2, 10*time.Second)
+	assert.Nil(t, err)
+
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, v interface{}) {
+		evicted = append(evicted, k, v)
+	})
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("k1", "v1")
+		ts.Advance(5 * time.Second)
+		c.Add("k2", "v2")
+		c.Add("k3", "v3")
+		assert.ArrayEqual(t, evicted, []interface{}{"k1", "v1"})
+
+		// expired entries are not reported
+		ts.Advance(10 * time.Second)
+		c.Add("k4", "v4")
+		c.Add("k5", "v5")
+		assert.ArrayEqual(t, evicted, []interface{}{"k1", "v1"})
+	})
+}
+
+func TestNewTTLWithOptions(t *testing.T) {
+	c, err := NewTTLWithOptions(10, 10*time.Second, TTLOptions{HardTTL: time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, c.(*ttlLruCache).hardTTL, 10*time.Second)
+
+	c, err = NewTTLWithOptions(10, 10*time.Second, TTLOptions{HardTTL: time.Minute})
+	assert.Nil(t, err)
+	assert.Equal(t, c.(*ttlLruCache).ttl, 10*time.Second)
+	assert.Equal(t, c.(*ttlLruCache).hardTTL, time.Minute)
+}
+
+func TestTTLCacheServesStale(t *testing.T) {
+	c, err := NewTTLWithOptions(10, 10*time.Second, TTLOptions{HardTTL: time.Minute})
+	assert.Nil(t, err)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("k", "v")
+		assert.Equal(t, c.Lookup("k"), Lookup{Value: "v", Status: LookupHit})
+
+		ts.Advance(10 * time.Second)
+		assert.Equal(t, c.Lookup("k"), Lookup{Value: "v", Status: LookupStale})
+		v, ok := c.Get("k")
+		assert.True(t, ok)
+		assert.Equal(t, v, "v")
+
+		ts.Advance(50 * time.Second)
+		assert.Equal(t, c.Lookup("k"), Lookup{Status: LookupMiss})
+		assert.Equal(t, c.Len(), 0)
+	})
+}
+
+func TestTTLCacheRefreshesStale(t *testing.T) {
+	loads := make(chan interface{}, 10)
+	release := make(chan error)
+	loader := func(key interface{}) (interface{}, error) {
+		loads <- key
+		if err := <-release; err != nil {
+			return nil, err
+		}
+		return "refreshed", nil
+	}
+
+	c, err := NewTTLWithOptions(
+		10,
+		10*time.Second,
+		TTLOptions{HardTTL: time.Minute, Loader: loader},
+	)
+	assert.Nil(t, err)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		waitForRefresh := func() {
+			for {
+				c.(*ttlLruCache).lock.Lock()
+				done := len(c.(*ttlLruCache).refreshing) == 0
+				c.(*ttlLruCache).lock.Unlock()
+				if done {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		c.Add("k", "v")
+		assert.Equal(t, c.Lookup("k").Status, LookupHit)
+		assert.Equal(t, len(loads), 0)
+
+		ts.Advance(10 * time.Second)
+		assert.Equal(t, c.Lookup("k"), Lookup{Value: "v", Status: LookupStale})
+		assert.Equal(t, <-loads, "k")
+
+		// Only one refresh per key is in flight.
+		assert.Equal(t, c.Lookup("k").Status, LookupStale)
+		assert.Equal(t, len(loads), 0)
+
+		// A failed refresh leaves the stale entry in place.
+		release <- errors.New("boom")
+		for {
+			if c.Lookup("k").Status == LookupStale && len(loads) == 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, <-loads, "k")
+
+		release <- nil
+		for c.Lookup("k").Status != LookupHit {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, c.Lookup("k"), Lookup{Value: "refreshed", Status: LookupHit})
+
+		ts.Advance(10 * time.Second)
+		assert.Equal(t, c.Lookup("k").Status, LookupStale)
+		assert.Equal(t, <-loads, "k")
+
+		// Keys removed while loading are not re-added.
+		c.Remove("k")
+		release <- nil
+		waitForRefresh()
+		assert.Equal(t, c.Lookup("k").Status, LookupMiss)
+
+		// Values added while loading are not overwritten.
+		c.Add("k", "v")
+		ts.Advance(10 * time.Second)
+		assert.Equal(t, c.Lookup("k").Status, LookupStale)
+		assert.Equal(t, <-loads, "k")
+		c.Add("k", "v2")
+		release <- nil
+		waitForRefresh()
+		assert.Equal(t, c.Lookup("k"), Lookup{Value: "v2", Status: LookupHit})
+
+		// Entries that expire while loading are not refreshed.
+		ts.Advance(10 * time.Second)
+		assert.Equal(t, c.Lookup("k").Status, LookupStale)
+		assert.Equal(t, <-loads, "k")
+		ts.Advance(time.Minute)
+		release <- nil
+		waitForRefresh()
+		assert.Equal(t, c.Lookup("k").Status, LookupMiss)
+	})
+}
+
+func TestNewTTLWithOptionsRefreshAhead(t *testing.T) {
+	loader := func(interface{}) (interface{}, error) { return nil, nil }
+
+	c, err := NewTTLWithOptions(10, time.Minute, TTLOptions{RefreshAhead: 0.5})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "Loader")
+
+	c, err = NewTTLWithOptions(10, time.Minute, TTLOptions{RefreshAhead: 1, Loader: loader})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "refresh ahead fraction")
+
+	c, err = NewTTLWithOptions(10, time.Minute, TTLOptions{RefreshWorkers: -1})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "refresh workers")
+
+	c, err = NewTTLWithOptions(10, time.Minute, TTLOptions{RefreshAhead: 0.25, Loader: loader})
+	assert.Nil(t, err)
+	assert.Equal(t, c.(*ttlLruCache).refreshAhead, 15*time.Second)
+	assert.Equal(t, cap(c.(*ttlLruCache).workers), DefaultRefreshWorkers)
+}
+
+func TestTTLCacheRefreshesAhead(t *testing.T) {
+	loads := make(chan interface{}, 10)
+	release := make(chan struct{})
+	loader := func(key interface{}) (interface{}, error) {
+		loads <- key
+		<-release
+		return key.(string) + "-refreshed", nil
+	}
+
+	c, err := NewTTLWithOptions(
+		10,
+		time.Minute,
+		TTLOptions{RefreshAhead: 0.25, RefreshWorkers: 1, Loader: loader},
+	)
+	assert.Nil(t, err)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("a", "a")
+		c.Add("b", "b")
+
+		ts.Advance(44 * time.Second)
+		assert.Equal(t, c.Lookup("a"), Lookup{Value: "a", Status: LookupHit})
+		assert.Equal(t, len(loads), 0)
+
+		ts.Advance(time.Second)
+		assert.Equal(t, c.Lookup("a"), Lookup{Value: "a", Status: LookupHit})
+		assert.Equal(t, <-loads, "a")
+
+		// The only worker is busy.
+		assert.Equal(t, c.Lookup("b"), Lookup{Value: "b", Status: LookupHit})
+		assert.Equal(t, len(loads), 0)
+		assert.Equal(t, c.RefreshStats(), RefreshStats{Started: 1, Dropped: 1})
+
+		release <- struct{}{}
+		for c.Lookup("a").Value != "a-refreshed" {
+			time.Sleep(time.Millisecond)
+		}
+
+		assert.Equal(t, c.Lookup("b").Value, "b")
+		assert.Equal(t, <-loads, "b")
+		release <- struct{}{}
+		for c.Lookup("b").Value != "b-refreshed" {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, c.RefreshStats(), RefreshStats{Started: 2, Succeeded: 2, Dropped: 1})
+
+		// Refreshed entries have a new TTL.
+		ts.Advance(44 * time.Second)
+		assert.Equal(t, c.Lookup("a"), Lookup{Value: "a-refreshed", Status: LookupHit})
+		assert.Equal(t, c.Lookup("b"), Lookup{Value: "b-refreshed", Status: LookupHit})
+		assert.Equal(t, len(loads), 0)
+	})
+}
+
+func TestTTLCacheNegativeEntries(t *testing.T) {
+	c, err := NewTTLWithOptions(2, time.Minute, TTLOptions{NegativeTTL: 10 * time.Second})
+	assert.Nil(t, err)
+
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, v interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		boom := errors.New("boom")
+		assert.False(t, c.Add("nil", nil))
+		assert.False(t, c.AddNegative("absent", nil))
+
+		assert.Equal(t, c.Lookup("nil"), Lookup{Status: LookupHit})
+		assert.Equal(t, c.Lookup("absent"), Lookup{Status: LookupNegative})
+		assert.Equal(t, c.Lookup("missing"), Lookup{Status: LookupMiss})
+
+		v, ok := c.Get("absent")
+		assert.Nil(t, v)
+		assert.False(t, ok)
+
+		assert.True(t, c.AddNegative("absent", boom))
+		assert.Equal(t, c.Lookup("absent"), Lookup{Status: LookupNegative, Err: boom})
+		assert.ArrayEqual(t, keys(c), []interface{}{"nil"})
+
+		ts.Advance(10 * time.Second)
+		assert.Equal(t, c.Lookup("absent"), Lookup{Status: LookupMiss})
+		assert.Equal(t, c.Lookup("nil"), Lookup{Status: LookupHit})
+
+		// Negative entries are replaced by values and are not reported when
+		// evicted.
+		c.AddNegative("x", nil)
+		assert.True(t, c.Add("x", "v"))
+		assert.Equal(t, c.Lookup("x"), Lookup{Value: "v", Status: LookupHit})
+
+		c.AddNegative("y", nil)
+		c.Add("z", "v")
+		assert.ArrayEqual(t, evicted, []interface{}{"nil", "x"})
+		c.Add("w", "v")
+		assert.ArrayEqual(t, evicted, []interface{}{"nil", "x"})
+	})
+}
+
+func TestTTLCacheJitter(t *testing.T) {
+	c, err := NewTTLWithOptions(10, time.Minute, TTLOptions{Jitter: time.Minute})
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "jitter")
+
+	c, err = NewTTLWithOptions(100, time.Minute, TTLOptions{Jitter: 30 * time.Second})
+	assert.Nil(t, err)
+
+	deadlines := func() []time.Time {
+		result := []time.Time{}
+		for i := 0; i < 100; i++ {
+			v, _ := c.(*ttlLruCache).lru.Peek(i)
+			result = append(result, v.(*entry).deadline)
+		}
+		return result
+	}
+
+	var first []time.Time
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		now := ts.Now()
+		for i := 0; i < 100; i++ {
+			c.Add(i, i)
+		}
+
+		first = deadlines()
+		distinct := map[time.Time]bool{}
+		for _, d := range first {
+			assert.False(t, d.Before(now.Add(30*time.Second)))
+			assert.False(t, d.After(now.Add(time.Minute)))
+			distinct[d] = true
+		}
+		assert.GreaterThan(t, len(distinct), 1)
+
+		// The same time source produces the same deadlines.
+		c, _ = NewTTLWithOptions(100, time.Minute, TTLOptions{Jitter: 30 * time.Second})
+		c.(*ttlLruCache).timeSource = ts
+		for i := 0; i < 100; i++ {
+			c.Add(i, i)
+		}
+		assert.ArrayEqual(t, deadlines(), first)
+	})
+}
+
+func TestTTLCacheRemoveIf(t *testing.T) {
+	c, _ := NewTTLWithOptions(10, time.Minute, TTLOptions{})
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("expired", 0)
+		ts.Advance(time.Minute)
+		c.Add("a", 1)
+		c.Add("b", 2)
+		c.AddNegative("c", nil)
+
+		seen := []interface{}{}
+		n := c.(BulkRemover).RemoveIf(func(k, v interface{}) bool {
+			seen = append(seen, k)
+			return v.(int) == 1
+		})
+		assert.Equal(t, n, 1)
+		assert.ArrayEqual(t, seen, []interface{}{"a", "b"})
+		assert.Equal(t, c.Len(), 2)
+		assert.ArrayEqual(t, keys(c), []interface{}{"b"})
+	})
+}
+
+func TestTTLCacheRemovePrefix(t *testing.T) {
+	c, _ := NewTTLWithOptions(10, time.Minute, TTLOptions{})
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("user/0", 0)
+		ts.Advance(time.Minute)
+		c.Add("user/1", 1)
+		c.AddNegative("user/2", nil)
+		c.Add("group/1", 3)
+		assert.Nil(t, c.(*ttlLruCache).prefixes)
+
+		assert.Equal(t, c.(BulkRemover).RemovePrefix("user/"), 1)
+		assert.Equal(t, c.Len(), 2)
+		assert.ArrayEqual(t, keys(c), []interface{}{"group/1"})
+		assert.ArrayEqual(t, c.(*ttlLruCache).prefixes.withPrefix(""), []string{"group/1", "user/2"})
+
+		// Negative entries are skipped by RemoveIf and RemovePrefix alike.
+		assert.Equal(t, c.(BulkRemover).RemoveIf(func(k, v interface{}) bool { return true }), 1)
+		assert.Equal(t, c.(BulkRemover).RemovePrefix(""), 0)
+		assert.Equal(t, c.Len(), 1)
+		assert.Equal(t, c.(TTLCache).Lookup("user/2").Status, LookupNegative)
+	})
+}
+
+func TestTTLCacheMulti(t *testing.T) {
+	c, _ := NewTTL(3, time.Minute)
+	mc := c.(MultiCache)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("expired", 0)
+		ts.Advance(time.Minute)
+
+		existed := mc.AddMulti([]KeyValue{{"a", 1}, {"b", 2}, {"a", 3}, {"expired", 4}})
+		assert.ArrayEqual(t, existed, []bool{false, false, true, false})
+
+		values, found := mc.GetMulti([]interface{}{"a", "b", "c"})
+		assert.ArrayEqual(t, values, []interface{}{3, 2, nil})
+		assert.ArrayEqual(t, found, []bool{true, true, false})
+
+		ts.Advance(30 * time.Second)
+		c.Add("c", 5)
+		ts.Advance(30 * time.Second)
+
+		removed := mc.RemoveMulti([]interface{}{"a", "c", "d"})
+		assert.ArrayEqual(t, removed, []bool{false, true, false})
+		assert.Equal(t, len(keys(c)), 0)
+	})
+}
+
+func TestTTLCacheInspect(t *testing.T) {
+	c, _ := NewTTL(2, time.Minute)
+	ic := c.(InspectableCache)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+		start := ts.Now()
+
+		c.Add("a", 1)
+		c.Add("b", 2)
+		c.(TTLCache).AddNegative("n", nil)
+
+		v, ok := ic.Peek("b")
+		assert.True(t, ok)
+		assert.Equal(t, v, 2)
+		assert.True(t, ic.Contains("b"))
+		assert.False(t, ic.Contains("n"))
+
+		ts.Advance(10 * time.Second)
+		c.Get("b")
+
+		info, ok := ic.GetEntry("b")
+		assert.True(t, ok)
+		assert.DeepEqual(t, info, EntryInfo{
+			Value:      2,
+			Added:      start,
+			Deadline:   start.Add(time.Minute),
+			TTL:        50 * time.Second,
+			Accesses:   1,
+			LastAccess: start.Add(10 * time.Second),
+		})
+
+		// Inspection does not affect eviction order.
+		c.Add("c", 3)
+		assert.True(t, ic.Contains("b"))
+		assert.True(t, ic.Contains("c"))
+
+		ts.Advance(50 * time.Second)
+		assert.False(t, ic.Contains("b"))
+		_, ok = ic.Peek("b")
+		assert.False(t, ok)
+		_, ok = ic.GetEntry("b")
+		assert.False(t, ok)
+	})
+}
+
+func TestTTLCacheResize(t *testing.T) {
+	c, _ := NewTTL(4, time.Minute)
+	r := c.(Resizable)
+
+	evicted := []interface{}{}
+	c.(EvictionNotifier).AddEvictionHook(func(k, _ interface{}) {
+		evicted = append(evicted, k)
+	})
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("a", 1)
+		ts.Advance(30 * time.Second)
+		c.Add("b", 2)
+		c.Add("c", 3)
+		c.Add("d", 4)
+		ts.Advance(30 * time.Second)
+
+		assert.ErrorContains(t, r.Resize(0), "positive size")
+
+		// The expired entry goes first, unreported.
+		assert.Nil(t, r.Resize(2))
+		assert.Equal(t, c.(*ttlLruCache).size, 2)
+		assert.ArrayEqual(t, evicted, []interface{}{"b"})
+		assert.ArrayEqual(t, keys(c), []interface{}{"c", "d"})
+
+		assert.Nil(t, r.Resize(3))
+		c.Add("e", 5)
+		assert.ArrayEqual(t, keys(c), []interface{}{"c", "d", "e"})
+		assert.ArrayEqual(t, evicted, []interface{}{"b"})
+	})
+}
+
+func TestTTLCacheRange(t *testing.T) {
+	c, _ := NewTTLWithOptions(10, time.Minute, TTLOptions{})
+	r := c.(Ranger)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*ttlLruCache).timeSource = ts
+
+		c.Add("expired", 0)
+		ts.Advance(time.Minute)
+		c.Add("a", 1)
+		ts.Advance(time.Second)
+		c.Add("b", 2)
+		c.AddNegative("n", nil)
+		c.Add("c", 3)
+		ts.Advance(time.Second)
+		c.Add("a", 4)
+		c.Get("b")
+
+		visited := []interface{}{}
+		visit := func(k, _ interface{}) bool {
+			visited = append(visited, k)
+			return true
+		}
+
+		r.Range(visit)
+		assert.ArrayEqual(t, visited, []interface{}{"c", "a", "b"})
+
+		visited = visited[:0]
+		r.RangeWithOptions(RangeOptions{Order: NewestFirst}, visit)
+		assert.ArrayEqual(t, visited, []interface{}{"b", "a", "c"})
+
+		visited = visited[:0]
+		r.RangeWithOptions(RangeOptions{Order: ExpiringFirst}, visit)
+		assert.ArrayEqual(t, visited, []interface{}{"c", "b", "a"})
+
+		visited = visited[:0]
+		r.RangeWithOptions(
+			RangeOptions{Order: ExpiringFirst, Snapshot: true},
+			func(k, _ interface{}) bool {
+				c.Remove(k)
+				visited = append(visited, k)
+				return len(visited) < 2
+			},
+		)
+		assert.ArrayEqual(t, visited, []interface{}{"c", "b"})
+		assert.ArrayEqual(t, keys(c), []interface{}{"a"})
+	})
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+)
+
+// NewWindowedCountingCache creates a CountingCache that counts only the additions
+// made within a sliding time window. Each key's window is divided into the given
+// number of buckets, each covering window / buckets of time; a bucket's count
+// leaves the window once that much time has passed since the bucket ended. For
+// example, a window of one minute with 60 buckets counts the additions made in the
+// last 59 to 60 seconds. Get, Add and ForEach return window totals, and keys whose
+// window total reaches zero are removed.
+//
+// The cache tracks at most size unique keys. When the number of keys in the cache
+// reaches size, keys whose windows have emptied are removed. If none have, the next
+// new key added randomly replaces a key among the set of keys with the smallest
+// window total. Size must be at least 2.
+func NewWindowedCountingCache(
+	size int,
+	window time.Duration,
+	buckets int,
+) (CountingCache, error) {
+	if size < 2 {
+		return nil, errors.New("minimum counting cache size is 2")
+	}
+
+	if buckets < 1 {
+		return nil, errors.New("Must provide a positive number of buckets")
+	}
+
+	width := window / time.Duration(buckets)
+	if width <= 0 {
+		return nil, errors.New("Must provide a window of at least one nanosecond per bucket")
+	}
+
+	return &windowed{
+		size:       size,
+		width:      width,
+		buckets:    buckets,
+		lookup:     make(map[string]*windowCounts, size),
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		timeSource: tbntime.NewSource(),
+	}, nil
+}
+
+type windowed struct {
+	size       int
+	width      time.Duration
+	buckets    int
+	lookup     map[string]*windowCounts
+	rng        *rand.Rand
+	truncated  bool
+	dropped    int
+	timeSource tbntime.Source
+	lock       sync.Mutex
+}
+
+type windowCounts struct {
+	counts []int
+	total  int
+	last   int64
+}
+
+// bucket returns the sequence number of the bucket containing the current time.
+func (c *windowed) bucket() int64 {
+	return c.timeSource.Now().UnixNano() / int64(c.width)
+}
+
+// advance discards counts from buckets that have left the window ending with the
+// given bucket.
+func (c *windowed) advance(w *windowCounts, b int64) {
+	if b <= w.last {
+		return
+	}
+
+	if b-w.last >= int64(c.buckets) {
+		for i := range w.counts {
+			w.counts[i] = 0
+		}
+		w.total = 0
+	} else {
+		for i := w.last + 1; i <= b; i++ {
+			idx := i % int64(c.buckets)
+			w.total -= w.counts[idx]
+			w.counts[idx] = 0
+		}
+	}
+
+	w.last = b
+}
+
+// expire advances every key's window and removes keys whose windows are empty.
+func (c *windowed) expire(b int64) {
+	for key, w := range c.lookup {
+		c.advance(w, b)
+		if w.total == 0 {
+			delete(c.lookup, key)
+		}
+	}
+}
+
+// evict randomly removes one of the keys with the smallest window total.
+func (c *windowed) evict() {
+	var candidates []string
+	min := 0
+	for key, w := range c.lookup {
+		switch {
+		case len(candidates) == 0 || w.total < min:
+			min = w.total
+			candidates = append(candidates[:0], key)
+		case w.total == min:
+			candidates = append(candidates, key)
+		}
+	}
+
+	if len(candidates) > 0 {
+		delete(c.lookup, candidates[c.rng.Intn(len(candidates))])
+
+		c.truncated = true
+		if min > 0 {
+			c.dropped += min
+		}
+	}
+}
+
+// sorted returns the window totals of all keys in descending order.
+func (c *windowed) sorted() []KeyCount {
+	c.expire(c.bucket())
+
+	result := make([]KeyCount, 0, len(c.lookup))
+	for key, w := range c.lookup {
+		result = append(result, KeyCount{Key: key, Count: w.total})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Count > result[j].Count })
+
+	return result
+}
+
+func (c *windowed) Get(key string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if w, ok := c.lookup[key]; ok {
+		c.advance(w, c.bucket())
+		if w.total == 0 {
+			delete(c.lookup, key)
+		}
+		return w.total
+	}
+
+	return 0
+}
+
+func (c *windowed) ForEach(f func(key string, count int)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.expire(c.bucket())
+
+	for key, w := range c.lookup {
+		f(key, w.total)
+	}
+}
+
+// ForEachSorted copies and sorts the window totals before invoking f.
+func (c *windowed) ForEachSorted(f func(key string, count int) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, kc := range c.sorted() {
+		if !f(kc.Key, kc.Count) {
+			return
+		}
+	}
+}
+
+func (c *windowed) TopK(k int) []KeyCount {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	sorted := c.sorted()
+	return sorted[:clampK(k, len(sorted))]
+}
+
+func (c *windowed) BottomK(k int) []KeyCount {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	sorted := c.sorted()
+	k = clampK(k, len(sorted))
+
+	result := make([]KeyCount, 0, k)
+	for i := len(sorted) - 1; i >= len(sorted)-k; i-- {
+		result = append(result, sorted[i])
+	}
+
+	return result
+}
+
+func (c *windowed) Add(key string, n int) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	b := c.bucket()
+	idx := b % int64(c.buckets)
+
+	if w, ok := c.lookup[key]; ok {
+		// Update existing entry.
+		c.advance(w, b)
+		w.counts[idx] += n
+		w.total += n
+
+		if w.total == 0 {
+			delete(c.lookup, key)
+		}
+
+		return w.total
+	}
+
+	// Only add new entries if their count is non-zero.
+	if n == 0 {
+		return n
+	}
+
+	// Insure we stay under the maximum size, preferring to drop empty windows.
+	if len(c.lookup) >= c.size {
+		c.expire(b)
+	}
+	for len(c.lookup) >= c.size {
+		c.evict()
+	}
+
+	w := &windowCounts{counts: make([]int, c.buckets), total: n, last: b}
+	w.counts[idx] = n
+	c.lookup[key] = w
+
+	return n
+}
+
+func (c *windowed) Inc(key string) int {
+	return c.Add(key, 1)
+}
+
+func (c *windowed) Dec(key string) int {
+	return c.Add(key, -1)
+}
+
+func (c *windowed) Remove(key string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if w, ok := c.lookup[key]; ok {
+		c.advance(w, c.bucket())
+		delete(c.lookup, key)
+		return w.total
+	}
+
+	return 0
+}
+
+func (c *windowed) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lookup = map[string]*windowCounts{}
+	c.truncated = false
+	c.dropped = 0
+}
+
+func (c *windowed) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.expire(c.bucket())
+	return len(c.lookup)
+}
+
+func (c *windowed) Snapshot() CountingSnapshot {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return newCountingSnapshot(c.size, c.sorted(), c.truncated, c.dropped)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	tbntime "github.com/turbinelabs/nonstdlib/time"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestNewWindowedCountingCache(t *testing.T) {
+	c, err := NewWindowedCountingCache(1, time.Minute, 60)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "minimum counting cache size")
+
+	c, err = NewWindowedCountingCache(2, time.Minute, 0)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "positive number of buckets")
+
+	c, err = NewWindowedCountingCache(2, 10, 60)
+	assert.Nil(t, c)
+	assert.ErrorContains(t, err, "at least one nanosecond per bucket")
+
+	c, err = NewWindowedCountingCache(2, time.Minute, 60)
+	assert.Nil(t, err)
+	assert.NonNil(t, c)
+	impl := c.(*windowed)
+	assert.Equal(t, impl.size, 2)
+	assert.Equal(t, impl.width, time.Second)
+	assert.Equal(t, impl.buckets, 60)
+	assert.NonNil(t, impl.lookup)
+	assert.NonNil(t, impl.rng)
+	assert.NonNil(t, impl.timeSource)
+}
+
+func TestWindowedCountingCacheAddGet(t *testing.T) {
+	c, _ := NewWindowedCountingCache(5, time.Minute, 60)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*windowed).timeSource = ts
+
+		assert.Equal(t, c.Add("a", 1), 1)
+		assert.Equal(t, c.Add("b", 2), 2)
+		assert.Equal(t, c.Add("a", 3), 4)
+		assert.Equal(t, c.Inc("c"), 1)
+		assert.Equal(t, c.Dec("b"), 1)
+		assert.Equal(t, c.Add("x", 0), 0)
+
+		assert.Equal(t, c.Get("a"), 4)
+		assert.Equal(t, c.Get("b"), 1)
+		assert.Equal(t, c.Get("c"), 1)
+		assert.Equal(t, c.Get("x"), 0)
+		assert.Equal(t, c.Len(), 3)
+
+		assert.Equal(t, c.Dec("c"), 0)
+		assert.Equal(t, c.Len(), 2)
+
+		assert.Equal(t, c.Remove("a"), 4)
+		assert.Equal(t, c.Remove("a"), 0)
+		contains(t, c, []string{"b:1"})
+	})
+}
+
+func TestWindowedCountingCacheSlides(t *testing.T) {
+	c, _ := NewWindowedCountingCache(5, time.Minute, 60)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*windowed).timeSource = ts
+
+		for i := 0; i < 10; i++ {
+			c.Inc("a")
+			ts.Advance(time.Second)
+		}
+		c.Add("b", 5)
+		assert.Equal(t, c.Get("a"), 10)
+
+		ts.Advance(49 * time.Second)
+		assert.Equal(t, c.Get("a"), 10)
+		contains(t, c, []string{"a:10", "b:5"})
+
+		ts.Advance(time.Second)
+		assert.Equal(t, c.Get("a"), 9)
+
+		ts.Advance(5 * time.Second)
+		assert.Equal(t, c.Inc("a"), 5)
+		contains(t, c, []string{"a:5", "b:5"})
+
+		ts.Advance(time.Hour)
+		assert.Equal(t, c.Len(), 0)
+		assert.Equal(t, c.Get("a"), 0)
+		assert.Equal(t, c.Get("b"), 0)
+	})
+}
+
+func TestWindowedCountingCacheEvictsEmptyWindowsFirst(t *testing.T) {
+	c, _ := NewWindowedCountingCache(2, time.Minute, 60)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*windowed).timeSource = ts
+
+		c.Add("a", 10)
+		ts.Advance(30 * time.Second)
+		c.Add("b", 1)
+		ts.Advance(30 * time.Second)
+
+		c.Add("c", 1)
+		contains(t, c, []string{"b:1", "c:1"})
+
+		c.Add("b", 1)
+		c.Add("d", 1)
+		contains(t, c, []string{"b:2", "d:1"})
+	})
+}
+
+func TestWindowedCountingCacheClear(t *testing.T) {
+	c, _ := NewWindowedCountingCache(5, time.Minute, 60)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	c.Clear()
+	assert.Equal(t, c.Len(), 0)
+
+	c.Add("x", 1)
+	contains(t, c, []string{"x:1"})
+}
+
+func TestWindowedCountingCacheSorted(t *testing.T) {
+	c, _ := NewWindowedCountingCache(5, time.Minute, 60)
+
+	tbntime.WithCurrentTimeFrozen(func(ts tbntime.ControlledSource) {
+		c.(*windowed).timeSource = ts
+
+		c.Add("a", 10)
+		ts.Advance(30 * time.Second)
+		c.Add("b", 5)
+		c.Add("c", 1)
+
+		assert.ArrayEqual(t, c.TopK(2), []KeyCount{{"a", 10}, {"b", 5}})
+		assert.ArrayEqual(t, c.BottomK(1), []KeyCount{{"c", 1}})
+
+		ts.Advance(30 * time.Second)
+		keys := []string{}
+		c.ForEachSorted(func(key string, _ int) bool {
+			keys = append(keys, key)
+			return true
+		})
+		assert.ArrayEqual(t, keys, []string{"b", "c"})
+	})
+}